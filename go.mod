@@ -10,5 +10,5 @@ require (
 	github.com/speps/go-hashids v2.0.0+incompatible
 	github.com/stretchr/testify v1.6.1
 	github.com/urfave/cli/v2 v2.3.0
-	github.com/youpy/go-wav v0.1.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
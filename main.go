@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/schollz/logger"
+	"github.com/schollz/teoperator/src/audio"
 	"github.com/schollz/teoperator/src/convert"
 	"github.com/schollz/teoperator/src/download"
 	"github.com/schollz/teoperator/src/ffmpeg"
+	"github.com/schollz/teoperator/src/inspect"
+	"github.com/schollz/teoperator/src/onset"
+	"github.com/schollz/teoperator/src/op1"
 	"github.com/schollz/teoperator/src/server"
 	cli "github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
 )
 
 func main() {
@@ -32,22 +43,140 @@ create a drum patch from one file (spliced at transients):
 	
     teoperator drum fullset.wav
 
+create a drum patch from one file, finding fewer and softer transients:
+	
+    teoperator drum --threshold 0.3 --onset complex fullset.wav
+
 create a drum patch from one file, spliced at even intervals:
 	
     teoperator drum --slices 16 fullset.wav
+
+create a drum patch from a loop, sliced on sixteenth notes from the first downbeat:
+	
+    teoperator drum --grid 1/16 drumloop.wav
+
+create drum patches from every sample in a folder, sorted by name:
+	
+    teoperator drum --sort name --exclude '*loop*' samples/
+
+create a drum patch from one file, with every hit at the same loudness:
+	
+    teoperator drum --normalize lufs:-16 --per-slice fullset.wav
+
+create a drum patch from one-shot files, with 10 ms of silence and fades between them:
+	
+    teoperator drum --gap 10 --fade-out 10 kick.wav snare.wav hihat.wav
+
+create a drum patch with a reversed 5th key and a gated 6th key pitched up 3 semitones:
+	
+    teoperator drum --key 5:reverse --key 6:gate,pitch=3 fullset.wav
+
+create drum patches in a folder, named like 'kick_op-z_1.aif':
+	
+    teoperator drum --device op-z --out patches --name '{name}_{device}_{n}.aif' samples/
 `
 	synthUsage := `
-create a synth patch from a sample:
+create a synth patch from a sample, detecting its pitch:
 	
     teoperator synth trumpet.wav
 
 create a synth patch from a sample with known frequency:
 	
-    teoperator synth --freq 220 trumpet_a2.wav`
+    teoperator synth --freq 220 trumpet_a2.wav
+
+create a synth patch for every wav in a folder:
+	
+    teoperator synth --include '*.wav' samples/
+
+create a synth patch from a sample, with its peak at -1 dB instead of -23 LUFS:
+	
+    teoperator synth --normalize peak:-1 trumpet.wav
+
+create a synth patch for the op-z:
+	
+    teoperator synth --device op-z trumpet.wav`
+	inspectUsage := `
+show the metadata and keys of a patch:
+	
+    teoperator inspect kit.aif
+
+show the keys of a drum patch under its waveform:
+	
+    teoperator inspect --waveform kit.aif
+
+print the metadata and keys of patches as json:
+	
+    teoperator inspect --json *.aif
+
+print a synth patch as yaml with the values of the op-1 screen:
+	
+    teoperator inspect --readable pad.aif > pad.yaml`
+	editUsage := `
+end the 5th key of a drum patch at 1.5 seconds and reverse it:
+	
+    teoperator edit --key 5:end=1.5,reverse kit.aif
+
+change the effect and octave of a patch, writing a new file:
+	
+    teoperator edit --set fx_type=cwo --set octave=1 --out kit2.aif kit.aif
+
+change patches with the fields and key settings of a json or yaml file:
+	
+    teoperator edit --patch changes.yaml *.aif`
+	randomUsage := `
+create 8 random synth patches:
+	
+    teoperator random
+
+create the same 16 patches again, in a folder:
+	
+    teoperator random -n 16 --seed 42 --out bank
+
+create random patches with only some engines and effects, and short attacks:
+	
+    teoperator random --engine cluster --engine dna --fx delay --attack 64:2000`
+	breedUsage := `
+create 8 mutations of a synth patch:
+	
+    teoperator breed bells.aif
+
+create 16 children of two synth patches, mutating fewer parameters:
+	
+    teoperator breed -n 16 --rate 0.05 --seed 42 --out children bells.aif pad.aif`
+	morphUsage := `
+create 8 patches that morph from one synth patch into another:
+	
+    teoperator morph bells.aif bells2.aif
+
+create 4 patches named pad_1.aif to pad_4.aif:
+	
+    teoperator morph -n 4 --name pad --out morphs pad.aif pad2.aif`
+	createUsage := `
+create a synth patch from a json or yaml file, written as pad.aif:
+	
+    teoperator create pad.yaml
+
+only the engines cluster, digital, dna and drwave, the effects nitro, cwo,
+delay and grid and the lfos element and tremolo have screen values. Others
+need the raw numbers of a device patch under raw_knobs or raw, see
+'teoperator inspect --readable'.
+
+create sampler patches with the audio of a patch, in a folder:
+	
+    teoperator create --audio piano.aif --out patches *.yaml`
+	normalizeUsage := "level of the audio: 'none', 'peak', 'rms' or 'lufs', with an optional target like 'lufs:-14'"
+	fileFlags := []cli.Flag{
+		&cli.StringSliceFlag{Name: "include", Usage: "only use files matching glob, like '*.wav'"},
+		&cli.StringSliceFlag{Name: "exclude", Usage: "skip files matching glob"},
+		&cli.StringFlag{Name: "sort", Usage: "sort files by 'name' or 'duration'"},
+		&cli.StringFlag{Name: "out", Usage: "folder for the patches (default: next to the input)"},
+		&cli.StringFlag{Name: "name", Value: convert.DefaultTemplate, Usage: "name of the patches, using {name}, {device}, {type}, {n} and {bpm}"},
+		&cli.StringFlag{Name: "collision", Value: convert.CollisionIncrement, Usage: "if a patch exists: 'increment', 'overwrite' or 'skip'"},
+	}
 	app := &cli.App{
 		Name:      "teoperator",
 		Usage:     "create patches for the op-1 or op-z",
-		UsageText: drumUsage + synthUsage,
+		UsageText: drumUsage + synthUsage + inspectUsage + editUsage + randomUsage + breedUsage + morphUsage + createUsage,
 	}
 	app.UseShortOptionHandling = true
 	app.Flags = []cli.Flag{
@@ -67,43 +196,440 @@ create a synth patch from a sample with known frequency:
 			Name:      "drum",
 			Usage:     "create drum patch from file(s)",
 			UsageText: drumUsage,
-			Flags: []cli.Flag{
-				&cli.IntFlag{Name: "slices", Usage: "number of slices", Value: 0},
-			},
+			Flags: append([]cli.Flag{
+				&cli.IntFlag{Name: "slices", Usage: "number of slices (default: slice at onsets)", Value: 0},
+				&cli.StringFlag{Name: "onset", Value: onset.DefaultOptions.Method, Usage: "onset detection (" + strings.Join(onset.Methods, ", ") + ")"},
+				&cli.Float64Flag{Name: "threshold", Value: onset.DefaultOptions.Threshold, Usage: "onset threshold from 0 to 1, higher finds fewer onsets"},
+				&cli.Float64Flag{Name: "min-interval", Value: onset.DefaultOptions.MinInterval, Usage: "minimum seconds between onsets"},
+				&cli.Float64Flag{Name: "silence", Value: onset.DefaultOptions.Silence, Usage: "level in dB below which there are no onsets"},
+				&cli.BoolFlag{Name: "backtrack", Value: onset.DefaultOptions.Backtrack, Usage: "move onsets to the start of the attack"},
+				&cli.StringFlag{Name: "grid", Usage: "slice on the beat grid from the first downbeat, like '1/16'"},
+				&cli.Float64Flag{Name: "bpm", Usage: "tempo for --grid (default: detected)"},
+				&cli.Float64Flag{Name: "zero-crossing", Usage: "milliseconds to search for a zero crossing at each slice point, like 5 (default: off)"},
+				&cli.StringSliceFlag{Name: "key", Usage: "key settings like '5:reverse,pitch=3,volume=80,playmode=gate'"},
+				&cli.StringFlag{Name: "normalize", Value: audio.None, Usage: normalizeUsage},
+				&cli.BoolFlag{Name: "per-slice", Usage: "normalize each slice on its own, to the peak if --normalize is not set"},
+				&cli.Float64Flag{Name: "fade-in", Value: audio.DefaultDeclick.FadeIn * 1000, Usage: "milliseconds of fade in at the start of each slice"},
+				&cli.Float64Flag{Name: "fade-out", Value: audio.DefaultDeclick.FadeOut * 1000, Usage: "milliseconds of fade out at the end of each slice"},
+				&cli.BoolFlag{Name: "dc-block", Value: audio.DefaultDeclick.DCBlock, Usage: "remove any offset from zero"},
+				&cli.Float64Flag{Name: "gap", Usage: "milliseconds of silence between files"},
+				&cli.StringFlag{Name: "device", Value: "op-1", Usage: "target device (" + strings.Join(op1.DeviceNames(), ", ") + ")"},
+			}, fileFlags...),
 			Action: func(c *cli.Context) error {
 				if c.Bool("debug") {
 					log.SetLevel("debug")
 				}
 
-				fnames := make([]string, c.Args().Len())
-				for i, _ := range fnames {
-					fnames[i] = c.Args().Get(i)
+				fnames, err := findFiles(c)
+				if err != nil {
+					return err
 				}
-				if len(fnames) == 0 {
-					return fmt.Errorf("need to specify filename")
+				device, err := op1.GetDevice(c.String("device"))
+				if err != nil {
+					return err
+				}
+				normalize := c.String("normalize")
+				if c.Bool("per-slice") && !c.IsSet("normalize") {
+					normalize = audio.Peak
+				}
+				normalization, err := audio.ParseNormalization(normalize)
+				if err != nil {
+					return err
+				}
+				if c.Bool("per-slice") && normalization.Mode == audio.None {
+					return fmt.Errorf("--per-slice needs a --normalize mode other than none")
 				}
-				return convert.ToDrum(fnames, c.Int("slices"))
+				normalization.PerSlice = c.Bool("per-slice")
+				return convert.ToDrum(c.Context, fnames, convert.Options{
+					Device:        device,
+					Normalization: normalization,
+					Declick: audio.Declick{
+						FadeIn:  c.Float64("fade-in") / 1000,
+						FadeOut: c.Float64("fade-out") / 1000,
+						DCBlock: c.Bool("dc-block"),
+						Gap:     c.Float64("gap") / 1000,
+					},
+					Slices:       c.Int("slices"),
+					Keys:         c.StringSlice("key"),
+					OutDir:       c.String("out"),
+					Template:     c.String("name"),
+					Collision:    c.String("collision"),
+					Grid:         c.String("grid"),
+					BPM:          c.Float64("bpm"),
+					ZeroCrossing: c.Float64("zero-crossing") / 1000,
+					Onset: onset.Options{
+						Method:      c.String("onset"),
+						Threshold:   c.Float64("threshold"),
+						MinInterval: c.Float64("min-interval"),
+						Silence:     c.Float64("silence"),
+						Backtrack:   c.Bool("backtrack"),
+					},
+				})
 			},
 		},
 		{
 			Name:      "synth",
 			Usage:     "create synth patch from file",
 			UsageText: synthUsage,
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{Name: "freq", Aliases: []string{"s"}, Value: "auto", Usage: "base frequency in hz, or 'auto' to detect it"},
+				&cli.StringFlag{Name: "normalize", Value: audio.DefaultNormalization.String(), Usage: normalizeUsage},
+				&cli.StringFlag{Name: "device", Value: "op-1", Usage: "target device (" + strings.Join(op1.DeviceNames(), ", ") + ")"},
+			}, fileFlags...),
+			Action: func(c *cli.Context) error {
+				if c.Bool("debug") {
+					log.SetLevel("debug")
+				}
+				fnames, err := findFiles(c)
+				if err != nil {
+					return err
+				}
+				device, err := op1.GetDevice(c.String("device"))
+				if err != nil {
+					return err
+				}
+				normalization, err := audio.ParseNormalization(c.String("normalize"))
+				if err != nil {
+					return err
+				}
+				baseFreq := 0.0
+				if c.String("freq") != "auto" {
+					baseFreq, err = strconv.ParseFloat(c.String("freq"), 64)
+					if err != nil || baseFreq <= 0 {
+						return fmt.Errorf("bad frequency '%s', use hz or 'auto'", c.String("freq"))
+					}
+				}
+				// one sampler patch per file
+				for _, fname := range fnames {
+					err = convert.ToSynth(c.Context, fname, convert.Options{
+						Device:        device,
+						BaseFreq:      baseFreq,
+						Normalization: normalization,
+						OutDir:        c.String("out"),
+						Template:      c.String("name"),
+						Collision:     c.String("collision"),
+					})
+					if err != nil {
+						return fmt.Errorf("%s: %s", fname, err.Error())
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "inspect",
+			Usage:     "show the metadata and keys of patches",
+			UsageText: inspectUsage,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "json", Usage: "print only json, one object per patch"},
+				&cli.BoolFlag{Name: "waveform", Usage: "draw the waveform with the start of each key"},
+				&cli.IntFlag{Name: "width", Value: 80, Usage: "characters of the waveform"},
+				&cli.IntFlag{Name: "height", Value: 8, Usage: "lines of the waveform"},
+				&cli.BoolFlag{Name: "readable", Usage: "print synth patches as yaml with the values of the op-1 screen, and raw numbers for engines, effects and lfos that are not measured"},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Bool("debug") {
+					log.SetLevel("debug")
+				}
+				if c.Args().Len() == 0 {
+					return fmt.Errorf("need to specify filename")
+				}
+				for _, fname := range c.Args().Slice() {
+					p, err := inspect.Read(fname)
+					if err != nil {
+						return err
+					}
+					if c.Bool("readable") {
+						sp, ok := p.Metadata.(op1.SynthPatch)
+						if !ok {
+							return fmt.Errorf("%s is not a synth patch", fname)
+						}
+						var b []byte
+						if c.Bool("json") {
+							b, _ = json.MarshalIndent(sp.Readable(), "", "  ")
+							b = append(b, '\n')
+						} else {
+							b, _ = yaml.Marshal(sp.Readable())
+						}
+						fmt.Print(string(b))
+						continue
+					}
+					if c.Bool("json") {
+						b, _ := json.MarshalIndent(p, "", "  ")
+						fmt.Println(string(b))
+						continue
+					}
+					b, _ := json.MarshalIndent(p.Metadata, "", "  ")
+					fmt.Println(string(b))
+					fmt.Println()
+					fmt.Print(p.Table())
+					if c.Bool("waveform") {
+						fmt.Println()
+						fmt.Print(p.Waveform(c.Int("width"), c.Int("height")))
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "edit",
+			Usage:     "change the metadata of patches, keeping their audio",
+			UsageText: editUsage,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{Name: "key", Usage: "key settings like '5:end=1.5,reverse,pitch=3'"},
+				&cli.StringSliceFlag{Name: "set", Usage: "metadata field like 'fx_type=cwo' or 'octave=1'"},
+				&cli.StringFlag{Name: "patch", Usage: "json or yaml file with metadata fields and a list of key settings"},
+				&cli.StringFlag{Name: "out", Usage: "file to write (default: change the patch in place)"},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Bool("debug") {
+					log.SetLevel("debug")
+				}
+				if c.Args().Len() == 0 {
+					return fmt.Errorf("need to specify filename")
+				}
+				if c.String("out") != "" && c.Args().Len() > 1 {
+					return fmt.Errorf("--out needs a single patch")
+				}
+				var changes op1.Changes
+				var err error
+				if c.String("patch") != "" {
+					changes, err = op1.ReadChanges(c.String("patch"))
+					if err != nil {
+						return err
+					}
+				}
+				for _, set := range c.StringSlice("set") {
+					err = changes.Set(set)
+					if err != nil {
+						return err
+					}
+				}
+				changes.Keys = append(changes.Keys, c.StringSlice("key")...)
+				for _, fname := range c.Args().Slice() {
+					fnameOut := fname
+					if c.String("out") != "" {
+						fnameOut = c.String("out")
+					}
+					err = op1.EditPatch(fname, fnameOut, changes)
+					if err != nil {
+						return fmt.Errorf("%s: %s", fname, err.Error())
+					}
+					fmt.Printf("edited %s -> %s\n", fname, fnameOut)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "random",
+			Usage:     "create random synth engine patches",
+			UsageText: randomUsage,
 			Flags: []cli.Flag{
-				&cli.Float64Flag{Name: "freq", Aliases: []string{"s"}, Value: 440, Usage: "base frequency"},
+				&cli.IntFlag{Name: "number", Aliases: []string{"n"}, Value: 8, Usage: "number of patches"},
+				&cli.Int64Flag{Name: "seed", Usage: "seed that makes the same patches again (default: random)"},
+				&cli.StringSliceFlag{Name: "engine", Usage: "only use engines like 'cluster' or 'dna', of the measured cluster, digital, dna and drwave"},
+				&cli.StringSliceFlag{Name: "fx", Usage: "only use effects like 'delay' or 'cwo', of the measured nitro, cwo, delay and grid"},
+				&cli.StringSliceFlag{Name: "lfo", Usage: "only use lfos like 'element', of the measured element and tremolo"},
+				&cli.StringFlag{Name: "attack", Usage: "range of the attack, like '64:4000'"},
+				&cli.StringFlag{Name: "decay", Usage: "range of the decay"},
+				&cli.StringFlag{Name: "sustain", Usage: "range of the sustain"},
+				&cli.StringFlag{Name: "release", Usage: "range of the release"},
+				&cli.StringFlag{Name: "out", Value: ".", Usage: "folder for the patches"},
 			},
 			Action: func(c *cli.Context) error {
 				if c.Bool("debug") {
 					log.SetLevel("debug")
 				}
-				fnames := make([]string, c.Args().Len())
-				for i, _ := range fnames {
-					fnames[i] = c.Args().Get(i)
+				constraints := op1.Constraints{
+					Engines: c.StringSlice("engine"),
+					Effects: c.StringSlice("fx"),
+					LFOs:    c.StringSlice("lfo"),
+				}
+				for i, name := range []string{"attack", "decay", "sustain", "release"} {
+					if c.String(name) == "" {
+						continue
+					}
+					bounds, err := op1.ParseBounds(c.String(name))
+					if err != nil {
+						return fmt.Errorf("%s: %s", name, err.Error())
+					}
+					constraints.ADSR[i] = &bounds
+				}
+				seed := c.Int64("seed")
+				if !c.IsSet("seed") {
+					seed = time.Now().UnixNano()
+				}
+				patches, err := op1.RandomSynthPatches(c.Int("number"), seed, constraints)
+				if err != nil {
+					return err
+				}
+				err = os.MkdirAll(c.String("out"), os.ModePerm)
+				if err != nil {
+					return err
+				}
+				for _, patch := range patches {
+					fname := filepath.Join(c.String("out"), patch.Encode()+".aif")
+					err = patch.SaveSynth(fname)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("created %s\n", fname)
+				}
+				fmt.Printf("made %d patches with seed %d\n", len(patches), seed)
+				return nil
+			},
+		},
+		{
+			Name:      "breed",
+			Usage:     "create children of one or two synth patches",
+			UsageText: breedUsage,
+			Flags: []cli.Flag{
+				&cli.IntFlag{Name: "number", Aliases: []string{"n"}, Value: 8, Usage: "number of children"},
+				&cli.Int64Flag{Name: "seed", Usage: "seed that makes the same children again (default: random)"},
+				&cli.Float64Flag{Name: "rate", Value: 0.2, Usage: "chance that each parameter is mutated, from 0 to 1"},
+				&cli.StringFlag{Name: "out", Value: ".", Usage: "folder for the patches"},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Bool("debug") {
+					log.SetLevel("debug")
 				}
-				if len(fnames) == 0 {
+				if c.Args().Len() < 1 || c.Args().Len() > 2 {
+					return fmt.Errorf("need one or two synth patches")
+				}
+				fnames := c.Args().Slice()
+				parents := make([]op1.SynthPatch, len(fnames))
+				for i, fname := range fnames {
+					var err error
+					parents[i], err = op1.ReadSynthPatch(fname)
+					if err != nil {
+						return err
+					}
+				}
+				seed := c.Int64("seed")
+				if !c.IsSet("seed") {
+					seed = time.Now().UnixNano()
+				}
+				children, err := op1.Breed(parents, c.Int("number"), seed, c.Float64("rate"))
+				if err != nil {
+					return err
+				}
+				err = os.MkdirAll(c.String("out"), os.ModePerm)
+				if err != nil {
+					return err
+				}
+				for _, child := range children {
+					// sampler patches keep the sample of their parent
+					fnameAudio := fnames[0]
+					for i, parent := range parents {
+						if parent.Type == child.Type && parent.BaseFreq == child.BaseFreq {
+							fnameAudio = fnames[i]
+							break
+						}
+					}
+					fname := filepath.Join(c.String("out"), child.Encode()+".aif")
+					err = child.SaveSynth(fname, fnameAudio)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("created %s\n", fname)
+				}
+				fmt.Printf("bred %d patches with seed %d\n", len(children), seed)
+				return nil
+			},
+		},
+		{
+			Name:      "morph",
+			Usage:     "create patches between two synth patches of the same engine",
+			UsageText: morphUsage,
+			Flags: []cli.Flag{
+				&cli.IntFlag{Name: "number", Aliases: []string{"n"}, Value: 8, Usage: "number of patches between"},
+				&cli.StringFlag{Name: "name", Value: "morph", Usage: "name of the patches, which are numbered"},
+				&cli.StringFlag{Name: "out", Value: ".", Usage: "folder for the patches"},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Bool("debug") {
+					log.SetLevel("debug")
+				}
+				if c.Args().Len() != 2 {
+					return fmt.Errorf("need two synth patches")
+				}
+				fnames := c.Args().Slice()
+				ends := make([]op1.SynthPatch, len(fnames))
+				for i, fname := range fnames {
+					var err error
+					ends[i], err = op1.ReadSynthPatch(fname)
+					if err != nil {
+						return err
+					}
+				}
+				patches, err := op1.Morph(ends[0], ends[1], c.Int("number"))
+				if err != nil {
+					return err
+				}
+				err = os.MkdirAll(c.String("out"), os.ModePerm)
+				if err != nil {
+					return err
+				}
+				digits := len(fmt.Sprint(len(patches)))
+				for i, patch := range patches {
+					// sampler patches keep the sample of their base frequency
+					fnameAudio := fnames[0]
+					if patch.BaseFreq != ends[0].BaseFreq {
+						fnameAudio = fnames[1]
+					}
+					fname := filepath.Join(c.String("out"), fmt.Sprintf("%s_%0*d.aif", c.String("name"), digits, i+1))
+					err = patch.SaveSynth(fname, fnameAudio)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("created %s\n", fname)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "create",
+			Usage:     "create synth patches from readable json or yaml files",
+			UsageText: createUsage,
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "audio", Usage: "aif with the audio of the patches (default: the op-1 default)"},
+				&cli.StringFlag{Name: "out", Usage: "folder for the patches (default: next to the input)"},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Bool("debug") {
+					log.SetLevel("debug")
+				}
+				if c.Args().Len() == 0 {
 					return fmt.Errorf("need to specify filename")
 				}
-				return convert.ToSynth(fnames[0], c.Float64("freq"))
+				var fnamesAudio []string
+				if c.String("audio") != "" {
+					fnamesAudio = append(fnamesAudio, c.String("audio"))
+				}
+				for _, fname := range c.Args().Slice() {
+					r, err := op1.ReadReadablePatch(fname)
+					if err != nil {
+						return err
+					}
+					sp, err := r.SynthPatch()
+					if err != nil {
+						return fmt.Errorf("%s: %s", fname, err.Error())
+					}
+					fnameOut := strings.TrimSuffix(fname, filepath.Ext(fname)) + ".aif"
+					if c.String("out") != "" {
+						err = os.MkdirAll(c.String("out"), os.ModePerm)
+						if err != nil {
+							return err
+						}
+						fnameOut = filepath.Join(c.String("out"), filepath.Base(fnameOut))
+					}
+					err = sp.SaveSynth(fnameOut, fnamesAudio...)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("created %s\n", fnameOut)
+				}
+				return nil
 			},
 		},
 		{
@@ -132,12 +658,32 @@ create a synth patch from a sample with known frequency:
 		},
 	}
 
-	err := app.Run(os.Args)
+	// interrupting stops any running ffmpeg
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := app.RunContext(ctx, os.Args)
 	if err != nil {
 		log.Error(err)
 	}
 }
 
+// findFiles expands the file, folder and glob arguments
+func findFiles(c *cli.Context) (fnames []string, err error) {
+	if c.Args().Len() == 0 {
+		err = fmt.Errorf("need to specify filename")
+		return
+	}
+	fnames, err = convert.FindFiles(c.Context, c.Args().Slice(), convert.FileOptions{
+		Include: c.StringSlice("include"),
+		Exclude: c.StringSlice("exclude"),
+		SortBy:  c.String("sort"),
+	})
+	if err == nil && len(fnames) == 0 {
+		err = fmt.Errorf("no files found")
+	}
+	return
+}
+
 func openbrowser(url string) {
 	var err error
 
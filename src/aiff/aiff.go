@@ -0,0 +1,455 @@
+package aiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// Chunk is a single chunk inside of the FORM container
+type Chunk struct {
+	ID   string
+	Data []byte
+}
+
+// File is an AIFF or AIFF-C file represented as a list of chunks
+type File struct {
+	// Type is either "AIFF" or "AIFC"
+	Type   string
+	Chunks []Chunk
+}
+
+// Decode parses the bytes of an AIFF or AIFF-C file into its chunks
+func Decode(b []byte) (f File, err error) {
+	if len(b) < 12 || string(b[:4]) != "FORM" {
+		err = fmt.Errorf("no FORM header")
+		return
+	}
+	f.Type = string(b[8:12])
+	if f.Type != "AIFF" && f.Type != "AIFC" {
+		err = fmt.Errorf("unknown form type '%s'", f.Type)
+		return
+	}
+
+	// some writers get the FORM size wrong, so trust the chunks instead
+	end := 8 + int(binary.BigEndian.Uint32(b[4:8]))
+	if end > len(b) || end < 12 {
+		end = len(b)
+	}
+	for pos := 12; pos+8 <= end; {
+		id := string(b[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(b[pos+4 : pos+8]))
+		pos += 8
+		if pos+size > len(b) {
+			err = fmt.Errorf("chunk '%s' is truncated", id)
+			return
+		}
+		f.Chunks = append(f.Chunks, Chunk{ID: id, Data: append([]byte{}, b[pos:pos+size]...)})
+		// chunks are padded to an even number of bytes
+		pos += size + size%2
+	}
+	return
+}
+
+// ReadFile reads and parses an AIFF or AIFF-C file
+func ReadFile(fname string) (f File, err error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return
+	}
+	f, err = Decode(b)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", fname, err.Error())
+	}
+	return
+}
+
+// Size returns the size declared in the FORM header
+func (f File) Size() (size int) {
+	size = 4
+	for _, c := range f.Chunks {
+		size += 8 + len(c.Data) + len(c.Data)%2
+	}
+	return
+}
+
+// Encode serializes the file, padding chunks to an even number of bytes
+func (f File) Encode() (b []byte) {
+	b = make([]byte, 0, 8+f.Size())
+	b = append(b, []byte("FORM")...)
+	b = appendUint32(b, uint32(f.Size()))
+	b = append(b, []byte(f.Type)...)
+	for _, c := range f.Chunks {
+		b = append(b, []byte(c.ID)...)
+		b = appendUint32(b, uint32(len(c.Data)))
+		b = append(b, c.Data...)
+		if len(c.Data)%2 == 1 {
+			b = append(b, 0)
+		}
+	}
+	return
+}
+
+// WriteFile writes the encoded file
+func (f File) WriteFile(fname string) (err error) {
+	return ioutil.WriteFile(fname, f.Encode(), 0644)
+}
+
+// Find returns the first chunk with the given ID
+func (f File) Find(id string) (c Chunk, ok bool) {
+	for _, c = range f.Chunks {
+		if c.ID == id {
+			ok = true
+			return
+		}
+	}
+	return
+}
+
+// Replace swaps the first chunk with the same ID, or inserts the
+// chunk in front of the sound data if there is none
+func (f *File) Replace(c Chunk) {
+	for i := range f.Chunks {
+		if f.Chunks[i].ID == c.ID {
+			f.Chunks[i] = c
+			return
+		}
+	}
+	f.insert(c)
+}
+
+// Remove removes all chunks with the given ID
+func (f *File) Remove(id string) {
+	chunks := f.Chunks[:0]
+	for _, c := range f.Chunks {
+		if c.ID != id {
+			chunks = append(chunks, c)
+		}
+	}
+	f.Chunks = chunks
+}
+
+// insert places the chunk right before the SSND chunk, which is
+// where the op-1 expects to find metadata
+func (f *File) insert(c Chunk) {
+	for i := range f.Chunks {
+		if f.Chunks[i].ID == "SSND" {
+			f.Chunks = append(f.Chunks[:i], append([]Chunk{c}, f.Chunks[i:]...)...)
+			return
+		}
+	}
+	f.Chunks = append(f.Chunks, c)
+}
+
+// Application returns the data of the APPL chunk with the given signature
+func (f File) Application(signature string) (data []byte, ok bool) {
+	for _, c := range f.Chunks {
+		if c.ID == "APPL" && len(c.Data) >= 4 && string(c.Data[:4]) == signature {
+			return c.Data[4:], true
+		}
+	}
+	return
+}
+
+// SetApplication replaces the data of the APPL chunk with the given
+// signature, adding the chunk if it does not exist
+func (f *File) SetApplication(signature string, data []byte) {
+	c := Chunk{ID: "APPL", Data: append([]byte(signature), data...)}
+	for i := range f.Chunks {
+		if f.Chunks[i].ID == "APPL" && len(f.Chunks[i].Data) >= 4 && string(f.Chunks[i].Data[:4]) == signature {
+			f.Chunks[i] = c
+			return
+		}
+	}
+	f.insert(c)
+}
+
+// Common is the COMM chunk
+type Common struct {
+	Channels     int
+	SampleFrames uint32
+	SampleSize   int
+	SampleRate   float64
+	// Compression and CompressionName are only used by AIFF-C
+	Compression     string
+	CompressionName string
+}
+
+// Common parses the COMM chunk
+func (f File) Common() (c Common, err error) {
+	chunk, ok := f.Find("COMM")
+	if !ok {
+		err = fmt.Errorf("no COMM chunk")
+		return
+	}
+	b := chunk.Data
+	if len(b) < 18 {
+		err = fmt.Errorf("COMM chunk is too short")
+		return
+	}
+	c.Channels = int(int16(binary.BigEndian.Uint16(b[0:2])))
+	c.SampleFrames = binary.BigEndian.Uint32(b[2:6])
+	c.SampleSize = int(int16(binary.BigEndian.Uint16(b[6:8])))
+	c.SampleRate = decodeExtended(b[8:18])
+	if f.Type == "AIFC" {
+		if len(b) < 22 {
+			err = fmt.Errorf("COMM chunk is missing compression")
+			return
+		}
+		c.Compression = string(b[18:22])
+		c.CompressionName, _ = decodePString(b[22:])
+	}
+	return
+}
+
+// SetCommon replaces the COMM chunk
+func (f *File) SetCommon(c Common) {
+	b := make([]byte, 0, 64)
+	b = appendUint16(b, uint16(c.Channels))
+	b = appendUint32(b, c.SampleFrames)
+	b = appendUint16(b, uint16(c.SampleSize))
+	b = append(b, encodeExtended(c.SampleRate)...)
+	if f.Type == "AIFC" {
+		compression := c.Compression
+		if compression == "" {
+			compression = "NONE"
+		}
+		b = append(b, []byte(compression)...)
+		b = append(b, encodePString(c.CompressionName)...)
+	}
+	f.Replace(Chunk{ID: "COMM", Data: b})
+}
+
+// SoundData is the SSND chunk
+type SoundData struct {
+	Offset    uint32
+	BlockSize uint32
+	Data      []byte
+}
+
+// SoundData parses the SSND chunk, skipping any offset bytes
+func (f File) SoundData() (s SoundData, err error) {
+	chunk, ok := f.Find("SSND")
+	if !ok {
+		err = fmt.Errorf("no SSND chunk")
+		return
+	}
+	if len(chunk.Data) < 8 {
+		err = fmt.Errorf("SSND chunk is too short")
+		return
+	}
+	s.Offset = binary.BigEndian.Uint32(chunk.Data[0:4])
+	s.BlockSize = binary.BigEndian.Uint32(chunk.Data[4:8])
+	if 8+int(s.Offset) > len(chunk.Data) {
+		err = fmt.Errorf("SSND offset is out of range")
+		return
+	}
+	s.Data = chunk.Data[8+s.Offset:]
+	return
+}
+
+// SetSoundData replaces the SSND chunk
+func (f *File) SetSoundData(s SoundData) {
+	b := make([]byte, 0, 8+int(s.Offset)+len(s.Data))
+	b = appendUint32(b, s.Offset)
+	b = appendUint32(b, s.BlockSize)
+	b = append(b, make([]byte, s.Offset)...)
+	b = append(b, s.Data...)
+	f.Replace(Chunk{ID: "SSND", Data: b})
+}
+
+// Marker is a single marker of the MARK chunk
+type Marker struct {
+	ID       int
+	Position uint32
+	Name     string
+}
+
+// Markers parses the MARK chunk, returning nothing if there is none
+func (f File) Markers() (markers []Marker, err error) {
+	chunk, ok := f.Find("MARK")
+	if !ok {
+		return
+	}
+	b := chunk.Data
+	if len(b) < 2 {
+		err = fmt.Errorf("MARK chunk is too short")
+		return
+	}
+	num := int(binary.BigEndian.Uint16(b[0:2]))
+	pos := 2
+	for i := 0; i < num; i++ {
+		if pos+6 > len(b) {
+			err = fmt.Errorf("MARK chunk is truncated")
+			return
+		}
+		var m Marker
+		m.ID = int(int16(binary.BigEndian.Uint16(b[pos : pos+2])))
+		m.Position = binary.BigEndian.Uint32(b[pos+2 : pos+6])
+		var n int
+		m.Name, n = decodePString(b[pos+6:])
+		pos += 6 + n
+		markers = append(markers, m)
+	}
+	return
+}
+
+// SetMarkers replaces the MARK chunk, removing it if there are no markers
+func (f *File) SetMarkers(markers []Marker) {
+	if len(markers) == 0 {
+		f.Remove("MARK")
+		return
+	}
+	b := appendUint16(nil, uint16(len(markers)))
+	for _, m := range markers {
+		b = appendUint16(b, uint16(m.ID))
+		b = appendUint32(b, m.Position)
+		b = append(b, encodePString(m.Name)...)
+	}
+	f.Replace(Chunk{ID: "MARK", Data: b})
+}
+
+// Loop is a sustain or release loop of the INST chunk
+type Loop struct {
+	PlayMode  int
+	BeginLoop int
+	EndLoop   int
+}
+
+// Instrument is the INST chunk
+type Instrument struct {
+	BaseNote     int
+	Detune       int
+	LowNote      int
+	HighNote     int
+	LowVelocity  int
+	HighVelocity int
+	Gain         int
+	SustainLoop  Loop
+	ReleaseLoop  Loop
+}
+
+// Instrument parses the INST chunk
+func (f File) Instrument() (inst Instrument, ok bool, err error) {
+	chunk, ok := f.Find("INST")
+	if !ok {
+		return
+	}
+	b := chunk.Data
+	if len(b) < 20 {
+		err = fmt.Errorf("INST chunk is too short")
+		return
+	}
+	inst.BaseNote = int(int8(b[0]))
+	inst.Detune = int(int8(b[1]))
+	inst.LowNote = int(int8(b[2]))
+	inst.HighNote = int(int8(b[3]))
+	inst.LowVelocity = int(int8(b[4]))
+	inst.HighVelocity = int(int8(b[5]))
+	inst.Gain = int(int16(binary.BigEndian.Uint16(b[6:8])))
+	inst.SustainLoop = decodeLoop(b[8:14])
+	inst.ReleaseLoop = decodeLoop(b[14:20])
+	return
+}
+
+// SetInstrument replaces the INST chunk
+func (f *File) SetInstrument(inst Instrument) {
+	b := []byte{
+		byte(int8(inst.BaseNote)),
+		byte(int8(inst.Detune)),
+		byte(int8(inst.LowNote)),
+		byte(int8(inst.HighNote)),
+		byte(int8(inst.LowVelocity)),
+		byte(int8(inst.HighVelocity)),
+	}
+	b = appendUint16(b, uint16(inst.Gain))
+	b = appendLoop(b, inst.SustainLoop)
+	b = appendLoop(b, inst.ReleaseLoop)
+	f.Replace(Chunk{ID: "INST", Data: b})
+}
+
+func decodeLoop(b []byte) Loop {
+	return Loop{
+		PlayMode:  int(int16(binary.BigEndian.Uint16(b[0:2]))),
+		BeginLoop: int(int16(binary.BigEndian.Uint16(b[2:4]))),
+		EndLoop:   int(int16(binary.BigEndian.Uint16(b[4:6]))),
+	}
+}
+
+func appendLoop(b []byte, l Loop) []byte {
+	b = appendUint16(b, uint16(l.PlayMode))
+	b = appendUint16(b, uint16(l.BeginLoop))
+	return appendUint16(b, uint16(l.EndLoop))
+}
+
+// utils
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// decodePString decodes a pascal-style string, returning the number
+// of bytes it used (including the pad byte)
+func decodePString(b []byte) (s string, n int) {
+	if len(b) == 0 {
+		return
+	}
+	length := int(b[0])
+	if 1+length > len(b) {
+		length = len(b) - 1
+	}
+	s = string(b[1 : 1+length])
+	n = 1 + length
+	if n%2 == 1 {
+		n++
+	}
+	return
+}
+
+func encodePString(s string) (b []byte) {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	b = append([]byte{byte(len(s))}, []byte(s)...)
+	if len(b)%2 == 1 {
+		b = append(b, 0)
+	}
+	return
+}
+
+// decodeExtended converts an 80-bit IEEE 754 extended float
+func decodeExtended(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b[0:2]))
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	sign := 1.0
+	if exponent&0x8000 != 0 {
+		sign = -1.0
+		exponent &= 0x7fff
+	}
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+	return sign * math.Ldexp(float64(mantissa), exponent-16383-63)
+}
+
+// encodeExtended converts to an 80-bit IEEE 754 extended float
+func encodeExtended(f float64) (b []byte) {
+	b = make([]byte, 10)
+	if f == 0 {
+		return
+	}
+	var sign uint16
+	if f < 0 {
+		sign = 0x8000
+		f = -f
+	}
+	frac, exp := math.Frexp(f)
+	binary.BigEndian.PutUint16(b[0:2], sign|uint16(exp-1+16383))
+	binary.BigEndian.PutUint64(b[2:10], uint64(math.Ldexp(frac, 64)))
+	return
+}
@@ -0,0 +1,111 @@
+package aiff
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	// files produced by the op-1
+	fnames, err := filepath.Glob("../op1/reverse/*/*.aif")
+	assert.Nil(t, err)
+	fnames = append(fnames, "../op1/tests/1.aif", "../ffmpeg/normalize.aif")
+	assert.NotEmpty(t, fnames)
+	for _, fname := range fnames {
+		b, err := ioutil.ReadFile(fname)
+		assert.Nil(t, err)
+		f, err := Decode(b)
+		assert.Nil(t, err, fname)
+		assert.Equal(t, b, f.Encode(), fname)
+	}
+}
+
+func TestOP1(t *testing.T) {
+	f, err := ReadFile("../op1/tests/1.aif")
+	assert.Nil(t, err)
+	assert.Equal(t, "AIFC", f.Type)
+
+	c, err := f.Common()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, c.Channels)
+	assert.Equal(t, 16, c.SampleSize)
+	assert.Equal(t, 44100.0, c.SampleRate)
+	assert.Equal(t, "sowt", c.Compression)
+
+	data, ok := f.Application("op-1")
+	assert.True(t, ok)
+	assert.Equal(t, byte('{'), data[0])
+
+	s, err := f.SoundData()
+	assert.Nil(t, err)
+	assert.Equal(t, int(c.SampleFrames)*2, len(s.Data))
+
+	// replacing the metadata keeps the sound in place
+	f.SetApplication("op-1", []byte(`{"type":"drum"}`+"\n"))
+	f2, err := Decode(f.Encode())
+	assert.Nil(t, err)
+	data, _ = f2.Application("op-1")
+	assert.Equal(t, `{"type":"drum"}`+"\n", string(data))
+	s2, err := f2.SoundData()
+	assert.Nil(t, err)
+	assert.Equal(t, s.Data, s2.Data)
+	assert.Equal(t, []string{"FVER", "COMM", "APPL", "SSND"}, ids(f2))
+}
+
+func TestSetApplication(t *testing.T) {
+	f, err := ReadFile("../ffmpeg/normalize.aif")
+	assert.Nil(t, err)
+	f.SetApplication("op-1", []byte("{}"))
+	f.SetApplication("op-1", []byte(`{"a":1}`))
+	assert.Equal(t, []string{"COMM", "APPL", "SSND"}, ids(f))
+
+	// odd sized chunks get padded
+	f2, err := Decode(f.Encode())
+	assert.Nil(t, err)
+	data, ok := f2.Application("op-1")
+	assert.True(t, ok)
+	assert.Equal(t, `{"a":1}`, string(data))
+	assert.Equal(t, 0, f2.Size()%2)
+}
+
+func TestMarkersAndInstrument(t *testing.T) {
+	f := File{Type: "AIFF"}
+	f.SetCommon(Common{Channels: 2, SampleFrames: 10, SampleSize: 16, SampleRate: 48000})
+	f.SetSoundData(SoundData{Data: make([]byte, 40)})
+	markers := []Marker{{ID: 1, Position: 0, Name: "start"}, {ID: 2, Position: 9, Name: "end!"}}
+	f.SetMarkers(markers)
+	inst := Instrument{BaseNote: 60, Detune: -3, LowNote: 0, HighNote: 127, LowVelocity: 1, HighVelocity: 127, Gain: -6,
+		SustainLoop: Loop{PlayMode: 1, BeginLoop: 1, EndLoop: 2}}
+	f.SetInstrument(inst)
+
+	f2, err := Decode(f.Encode())
+	assert.Nil(t, err)
+	c, err := f2.Common()
+	assert.Nil(t, err)
+	assert.Equal(t, 48000.0, c.SampleRate)
+	assert.Equal(t, 2, c.Channels)
+	markers2, err := f2.Markers()
+	assert.Nil(t, err)
+	assert.Equal(t, markers, markers2)
+	inst2, ok, err := f2.Instrument()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, inst, inst2)
+}
+
+func TestExtended(t *testing.T) {
+	for _, f := range []float64{0, 1, 8000, 22050, 44100, 48000, 96000, -3.5} {
+		assert.Equal(t, f, decodeExtended(encodeExtended(f)))
+	}
+	assert.Equal(t, []byte{0x40, 0x0e, 0xac, 0x44, 0, 0, 0, 0, 0, 0}, encodeExtended(44100))
+}
+
+func ids(f File) (s []string) {
+	for _, c := range f.Chunks {
+		s = append(s, c.ID)
+	}
+	return
+}
@@ -0,0 +1,185 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+// Buffer is decoded audio in memory
+type Buffer struct {
+	SampleRate int
+	Channels   int
+	// Samples are interleaved by channel, between -1 and 1
+	Samples []float64
+}
+
+// Frames returns the number of samples per channel
+func (b *Buffer) Frames() int {
+	if b.Channels == 0 {
+		return 0
+	}
+	return len(b.Samples) / b.Channels
+}
+
+// Duration returns the length in seconds
+func (b *Buffer) Duration() float64 {
+	if b.SampleRate == 0 {
+		return 0
+	}
+	return float64(b.Frames()) / float64(b.SampleRate)
+}
+
+// Copy returns a buffer that does not share samples
+func (b *Buffer) Copy() *Buffer {
+	b2 := *b
+	b2.Samples = append([]float64{}, b.Samples...)
+	return &b2
+}
+
+// Mono returns the samples mixed to one channel, which are shared with the
+// buffer if it is mono
+func (b *Buffer) Mono() []float64 {
+	if b.Channels == 1 {
+		return b.Samples
+	}
+	mono := make([]float64, b.Frames())
+	for i := range mono {
+		for c := 0; c < b.Channels; c++ {
+			mono[i] += b.Samples[i*b.Channels+c]
+		}
+		mono[i] /= float64(b.Channels)
+	}
+	return mono
+}
+
+// ToChannels returns the audio mixed down to mono, or with mono copied to
+// every channel
+func (b *Buffer) ToChannels(channels int) *Buffer {
+	if channels == b.Channels {
+		return b.Copy()
+	}
+	mono := b.Mono()
+	b2 := &Buffer{SampleRate: b.SampleRate, Channels: channels, Samples: make([]float64, len(mono)*channels)}
+	for i, x := range mono {
+		for c := 0; c < channels; c++ {
+			b2.Samples[i*channels+c] = x
+		}
+	}
+	return b2
+}
+
+// Trim returns the audio between two times in seconds, an end of 0 or past
+// the end keeps the rest
+func (b *Buffer) Trim(start float64, end float64) *Buffer {
+	first := b.frame(start)
+	last := b.Frames()
+	if end > 0 && b.frame(end) < last {
+		last = b.frame(end)
+	}
+	if last < first {
+		last = first
+	}
+	return &Buffer{
+		SampleRate: b.SampleRate,
+		Channels:   b.Channels,
+		Samples:    append([]float64{}, b.Samples[first*b.Channels:last*b.Channels]...),
+	}
+}
+
+func (b *Buffer) frame(seconds float64) (frame int) {
+	frame = int(math.Round(seconds * float64(b.SampleRate)))
+	if frame < 0 {
+		frame = 0
+	}
+	if frame > b.Frames() {
+		frame = b.Frames()
+	}
+	return
+}
+
+// Convert returns at most the first seconds of the audio at a sample rate
+// and number of channels
+func (b *Buffer) Convert(sampleRate int, channels int, seconds float64) *Buffer {
+	return b.Trim(0, seconds).ToChannels(channels).Resample(sampleRate)
+}
+
+// Concatenate joins buffers with the same sample rate and channels
+func Concatenate(buffers ...*Buffer) (b *Buffer, err error) {
+	if len(buffers) == 0 {
+		err = fmt.Errorf("nothing to concatenate")
+		return
+	}
+	b = &Buffer{SampleRate: buffers[0].SampleRate, Channels: buffers[0].Channels}
+	for _, b2 := range buffers {
+		if b2.SampleRate != b.SampleRate || b2.Channels != b.Channels {
+			err = fmt.Errorf("cannot concatenate %d hz/%d channels with %d hz/%d channels",
+				b.SampleRate, b.Channels, b2.SampleRate, b2.Channels)
+			return
+		}
+		b.Samples = append(b.Samples, b2.Samples...)
+	}
+	return
+}
+
+// Gain changes the level by decibels
+func (b *Buffer) Gain(db float64) {
+	factor := math.Pow(10, db/20)
+	for i := range b.Samples {
+		b.Samples[i] *= factor
+	}
+}
+
+// Peak returns the loudest sample in decibels
+func (b *Buffer) Peak() float64 {
+	peak := 0.0
+	for _, x := range b.Samples {
+		peak = math.Max(peak, math.Abs(x))
+	}
+	return 20 * math.Log10(peak)
+}
+
+// RMS returns the average level in decibels
+func (b *Buffer) RMS() float64 {
+	power := 0.0
+	for _, x := range b.Samples {
+		power += x * x
+	}
+	return 10 * math.Log10(power/float64(len(b.Samples)))
+}
+
+// FirstSound returns the seconds of the first sample louder than db
+func (b *Buffer) FirstSound(db float64) float64 {
+	threshold := math.Pow(10, db/20)
+	for i, x := range b.Samples {
+		if math.Abs(x) > threshold {
+			return float64(i/b.Channels) / float64(b.SampleRate)
+		}
+	}
+	return 0
+}
+
+// RemoveSilence returns the audio without any stretch quieter than db that
+// is longer than minSeconds
+func (b *Buffer) RemoveSilence(db float64, minSeconds float64) *Buffer {
+	threshold := math.Pow(10, db/20)
+	minFrames := int(minSeconds * float64(b.SampleRate))
+	b2 := &Buffer{SampleRate: b.SampleRate, Channels: b.Channels}
+	quiet := 0
+	for i := 0; i < b.Frames(); i++ {
+		frame := b.Samples[i*b.Channels : (i+1)*b.Channels]
+		loud := false
+		for _, x := range frame {
+			loud = loud || math.Abs(x) > threshold
+		}
+		if loud {
+			quiet = 0
+		} else {
+			quiet++
+		}
+		// keep the start of each silence so sounds still decay
+		if quiet <= minFrames {
+			b2.Samples = append(b2.Samples, frame...)
+		}
+	}
+	return b2
+}
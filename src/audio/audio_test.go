@@ -0,0 +1,265 @@
+package audio
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sine(frequency float64, sampleRate int, seconds float64, channels int) *Buffer {
+	b := &Buffer{SampleRate: sampleRate, Channels: channels}
+	for i := 0; i < int(seconds*float64(sampleRate)); i++ {
+		x := 0.5 * math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate))
+		for c := 0; c < channels; c++ {
+			b.Samples = append(b.Samples, x)
+		}
+	}
+	return b
+}
+
+// zeroCrossings counts rising zero crossings to estimate a frequency
+func zeroCrossings(samples []float64) (n int) {
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1] < 0 && samples[i] >= 0 {
+			n++
+		}
+	}
+	return
+}
+
+func TestWAV(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "sine.wav")
+	b := sine(440, 48000, 0.5, 2)
+	assert.Nil(t, b.WriteWAV(fname))
+	b2, err := Decode(fname)
+	assert.Nil(t, err)
+	assert.Equal(t, 48000, b2.SampleRate)
+	assert.Equal(t, 2, b2.Channels)
+	assert.Equal(t, b.Frames(), b2.Frames())
+	for i := range b.Samples {
+		assert.InDelta(t, b.Samples[i], b2.Samples[i], 1e-4)
+	}
+
+	// streamed wavs do not know their size
+	data, err := os.ReadFile(fname)
+	assert.Nil(t, err)
+	copy(data[40:], []byte{0xff, 0xff, 0xff, 0xff})
+	b2, err = DecodeWAV(data)
+	assert.Nil(t, err)
+	assert.Equal(t, b.Frames(), b2.Frames())
+
+	_, err = DecodeWAV([]byte("not a wav file"))
+	assert.NotNil(t, err)
+}
+
+func TestAIFF(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "sine.aif")
+	b := sine(440, 44100, 0.5, 1)
+	f := b.AIFF()
+	assert.Nil(t, f.WriteFile(fname))
+	b2, err := Decode(fname)
+	assert.Nil(t, err)
+	assert.Equal(t, 44100, b2.SampleRate)
+	assert.Equal(t, 1, b2.Channels)
+	assert.Equal(t, b.Frames(), b2.Frames())
+	for i := range b.Samples {
+		assert.InDelta(t, b.Samples[i], b2.Samples[i], 1e-4)
+	}
+}
+
+func TestDecodeRange(t *testing.T) {
+	b := sine(440, 44100, 2, 2)
+	for _, ext := range []string{".wav", ".aif"} {
+		fname := filepath.Join(t.TempDir(), "sine"+ext)
+		if ext == ".wav" {
+			assert.Nil(t, b.WriteWAV(fname))
+		} else {
+			f := b.AIFF()
+			assert.Nil(t, f.WriteFile(fname))
+		}
+		b2, err := DecodeRange(context.Background(), fname, 0.5, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, 44100, b2.Frames(), ext)
+		assert.InDelta(t, b.Samples[22050*2+100], b2.Samples[100], 1e-4, ext)
+
+		// ranges past the end stop at the end
+		b2, err = DecodeRange(context.Background(), fname, 1.5, 10)
+		assert.Nil(t, err)
+		assert.Equal(t, 22050, b2.Frames(), ext)
+		b2, err = DecodeRange(context.Background(), fname, 3, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, b2.Frames(), ext)
+	}
+}
+
+func TestDecodeInts(t *testing.T) {
+	samples, err := decodeInts([]byte{0x80, 0x00, 0x7f, 0xff}, 16, binary.BigEndian)
+	assert.Nil(t, err)
+	assert.Equal(t, -1.0, samples[0])
+	assert.InDelta(t, 1.0, samples[1], 1e-4)
+
+	samples, err = decodeInts([]byte{0x00, 0x00, 0x80, 0xff, 0xff, 0x7f}, 24, binary.LittleEndian)
+	assert.Nil(t, err)
+	assert.Equal(t, -1.0, samples[0])
+	assert.InDelta(t, 1.0, samples[1], 1e-4)
+
+	// 8-bit wavs are unsigned
+	samples, err = decodeInts([]byte{0, 128}, 8, binary.LittleEndian)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{-1, 0}, samples)
+}
+
+func TestResample(t *testing.T) {
+	b := sine(1000, 48000, 1, 1)
+	b2 := b.Resample(44100)
+	assert.Equal(t, 44100, b2.SampleRate)
+	assert.Equal(t, 44100, b2.Frames())
+	assert.InDelta(t, 1000, zeroCrossings(b2.Samples), 2)
+	assert.InDelta(t, b.Peak(), b2.Peak(), 0.1)
+
+	// frequencies above the new nyquist frequency are removed
+	b = sine(15000, 44100, 1, 1)
+	b2 = b.Resample(22050)
+	assert.Less(t, b2.Trim(0.1, 0.9).Peak(), -30.0)
+}
+
+func TestChannels(t *testing.T) {
+	b := &Buffer{SampleRate: 10, Channels: 2, Samples: []float64{1, 0, 0.5, 0.5}}
+	assert.Equal(t, []float64{0.5, 0.5}, b.Mono())
+	assert.Equal(t, []float64{0.5, 0.5, 0.5, 0.5}, b.ToChannels(1).ToChannels(2).Samples)
+	assert.Equal(t, 2, b.ToChannels(1).Frames())
+	assert.Equal(t, 2, b.ToChannels(2).Frames())
+}
+
+func TestTrimAndConcatenate(t *testing.T) {
+	b := &Buffer{SampleRate: 10, Channels: 1, Samples: []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}}
+	assert.Equal(t, []float64{2, 3, 4}, b.Trim(0.2, 0.5).Samples)
+	assert.Equal(t, []float64{8, 9}, b.Trim(0.8, 0).Samples)
+	assert.Equal(t, []float64{8, 9}, b.Trim(0.8, 10).Samples)
+	assert.Empty(t, b.Trim(2, 3).Samples)
+	assert.Equal(t, 1.0, b.Duration())
+
+	b2, err := Concatenate(b.Trim(0, 0.2), b.Trim(0.8, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{0, 1, 8, 9}, b2.Samples)
+	_, err = Concatenate(b, b.ToChannels(2))
+	assert.NotNil(t, err)
+	_, err = Concatenate()
+	assert.NotNil(t, err)
+}
+
+func TestLevels(t *testing.T) {
+	b := sine(440, 44100, 1, 1)
+	assert.InDelta(t, -6.02, b.Peak(), 0.01)
+	b.Gain(6.02)
+	assert.InDelta(t, 0, b.Peak(), 0.01)
+
+	// a full scale 1 khz sine is -3.01 LUFS
+	b = sine(1000, 48000, 2, 1)
+	b.Gain(6.0206)
+	assert.InDelta(t, -3.01, b.Loudness(), 0.1)
+	assert.InDelta(t, -3.01, b.RMS(), 0.01)
+
+	silence := &Buffer{SampleRate: 44100, Channels: 1, Samples: make([]float64, 44100)}
+	assert.True(t, math.IsInf(silence.Loudness(), -1))
+}
+
+func TestNormalization(t *testing.T) {
+	n, err := ParseNormalization("lufs")
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultNormalization, n)
+	n, err = ParseNormalization("Peak:-0.5")
+	assert.Nil(t, err)
+	assert.Equal(t, Normalization{Mode: Peak, Target: -0.5, Ceiling: -2}, n)
+	assert.Equal(t, "peak:-0.5", n.String())
+	n, err = ParseNormalization("")
+	assert.Nil(t, err)
+	assert.Equal(t, None, n.Mode)
+	for _, bad := range []string{"loud", "rms:x", "rms:3", "none:-3"} {
+		_, err = ParseNormalization(bad)
+		assert.NotNil(t, err, bad)
+	}
+
+	b := sine(1000, 48000, 2, 1)
+	gain := DefaultNormalization.Apply(b)
+	// half scale is 6 dB below -3.01 LUFS
+	assert.InDelta(t, -23-(-3.01-6.02), gain, 0.1)
+	assert.InDelta(t, -23, b.Loudness(), 0.1)
+	// the ceiling limits the gain
+	Normalization{Mode: LUFS, Target: 0, Ceiling: -2}.Apply(b)
+	assert.InDelta(t, -2, b.Peak(), 0.01)
+	Normalization{Mode: RMS, Target: -12, Ceiling: 0}.Apply(b)
+	assert.InDelta(t, -12, b.RMS(), 0.01)
+	Normalization{Mode: Peak, Target: -1}.Apply(b)
+	assert.InDelta(t, -1, b.Peak(), 0.01)
+	assert.Equal(t, 0.0, Normalization{Mode: None}.Apply(b))
+
+	silence := &Buffer{SampleRate: 44100, Channels: 1, Samples: make([]float64, 44100)}
+	assert.Equal(t, 0.0, DefaultNormalization.Apply(silence))
+}
+
+func TestNormalizeSlices(t *testing.T) {
+	// a loud and a quiet hit
+	b := &Buffer{SampleRate: 100, Channels: 1, Samples: make([]float64, 40)}
+	b.Samples[0] = 0.5
+	b.Samples[20] = 0.05
+	n := Normalization{Mode: Peak, Target: 0}
+	// the second and third key play the same slice, the last is past the end
+	gains := n.ApplySlices(b, []int{0, 20, 20, 50}, []int{30, 40, 40, 60})
+	assert.Len(t, gains, 2)
+	assert.InDelta(t, 1, b.Samples[0], 1e-9)
+	assert.InDelta(t, 1, b.Samples[20], 1e-9)
+}
+
+func TestSilence(t *testing.T) {
+	b := &Buffer{SampleRate: 100, Channels: 1, Samples: make([]float64, 300)}
+	b.Samples[50] = 0.5
+	b.Samples[250] = 0.5
+	assert.Equal(t, 0.5, b.FirstSound(-30))
+	b2 := b.RemoveSilence(-50, 0.1)
+	// the leading silence is shortened to 0.1 s, and so is the gap
+	assert.Equal(t, 10+1+10+1+10, b2.Frames())
+	assert.Equal(t, 0.5, b2.Samples[10])
+	assert.Equal(t, 0.5, b2.Samples[21])
+}
+
+func TestDeclick(t *testing.T) {
+	// an offset goes away after a few time constants of the filter
+	b := &Buffer{SampleRate: 1000, Channels: 2, Samples: make([]float64, 2000)}
+	for i := range b.Samples {
+		b.Samples[i] = 0.25
+	}
+	b.RemoveDC()
+	assert.InDelta(t, 0, b.Samples[len(b.Samples)-1], 1e-3)
+	assert.InDelta(t, 0, b.Samples[len(b.Samples)-2], 1e-3)
+
+	// fades reach zero at the edges and are shortened to fit
+	b = &Buffer{SampleRate: 100, Channels: 1, Samples: []float64{1, 1, 1, 1, 1, 1}}
+	b.Fade(2, 4)
+	assert.Equal(t, []float64{0, 0.5, 0.75, 0.5, 0.25, 0}, b.Samples)
+	b = &Buffer{SampleRate: 100, Channels: 1, Samples: []float64{1, 1}}
+	b.Fade(4, 4)
+	assert.Equal(t, []float64{0, 0}, b.Samples)
+
+	// joined buffers are faded and separated by gaps
+	d := Declick{FadeIn: 0.02, FadeOut: 0.02, Gap: 0.03}
+	one := &Buffer{SampleRate: 100, Channels: 1, Samples: []float64{1, 1, 1, 1, 1}}
+	joined, starts, ends, err := d.Join(one, one)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 8}, starts)
+	assert.Equal(t, []int{5, 13}, ends)
+	assert.Equal(t, []float64{0, 0.5, 1, 0.5, 0, 0, 0, 0, 0, 0.5, 1, 0.5, 0}, joined.Samples)
+	assert.Equal(t, 1.0, one.Samples[0])
+	_, _, _, err = d.Join()
+	assert.NotNil(t, err)
+
+	// slices of one buffer are faded at each of their edges
+	b = &Buffer{SampleRate: 100, Channels: 1, Samples: []float64{1, 1, 1, 1, 1, 1, 1, 1}}
+	Declick{FadeIn: 0.01, FadeOut: 0.01}.ApplySlices(b, []int{0, 4}, []int{4, 8})
+	assert.Equal(t, []float64{0, 1, 1, 0, 0, 1, 1, 0}, b.Samples)
+}
@@ -0,0 +1,105 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+// dcCutoff is the frequency in hz below which DC blocking removes audio
+const dcCutoff = 10
+
+// Declick removes clicks at the edges of slices
+type Declick struct {
+	// FadeIn and FadeOut are the seconds of fade at the start and end of
+	// every slice
+	FadeIn  float64
+	FadeOut float64
+	// DCBlock removes any offset from zero
+	DCBlock bool
+	// Gap is the seconds of silence between joined buffers
+	Gap float64
+}
+
+// DefaultDeclick fades every slice and removes offsets, without gaps
+var DefaultDeclick = Declick{FadeIn: 0.001, FadeOut: 0.005, DCBlock: true}
+
+// Apply removes the offset of the audio and fades its start and end
+func (d Declick) Apply(b *Buffer) {
+	if d.DCBlock {
+		b.RemoveDC()
+	}
+	b.Fade(int(d.FadeIn*float64(b.SampleRate)), int(d.FadeOut*float64(b.SampleRate)))
+}
+
+// ApplySlices removes the offset of the audio and fades each slice between
+// start and end frames
+func (d Declick) ApplySlices(b *Buffer, starts []int, ends []int) {
+	if d.DCBlock {
+		b.RemoveDC()
+	}
+	for _, r := range b.regions(starts, ends) {
+		r.Fade(int(d.FadeIn*float64(b.SampleRate)), int(d.FadeOut*float64(b.SampleRate)))
+	}
+}
+
+// Join declicks copies of the buffers and concatenates them with gaps of
+// silence in between. It returns the start and end frame of each buffer.
+func (d Declick) Join(buffers ...*Buffer) (b *Buffer, starts []int, ends []int, err error) {
+	if len(buffers) == 0 {
+		err = fmt.Errorf("nothing to join")
+		return
+	}
+	gap := &Buffer{SampleRate: buffers[0].SampleRate, Channels: buffers[0].Channels}
+	gap.Samples = make([]float64, int(d.Gap*float64(gap.SampleRate))*gap.Channels)
+	var parts []*Buffer
+	frames := 0
+	for i, source := range buffers {
+		if i > 0 && gap.Frames() > 0 {
+			parts = append(parts, gap)
+			frames += gap.Frames()
+		}
+		part := source.Copy()
+		d.Apply(part)
+		parts = append(parts, part)
+		starts = append(starts, frames)
+		frames += part.Frames()
+		ends = append(ends, frames)
+	}
+	b, err = Concatenate(parts...)
+	return
+}
+
+// RemoveDC removes any offset from zero with a one-pole high-pass filter
+func (b *Buffer) RemoveDC() {
+	r := 1 - 2*math.Pi*dcCutoff/float64(b.SampleRate)
+	for c := 0; c < b.Channels; c++ {
+		var x1, y1 float64
+		for i := c; i < len(b.Samples); i += b.Channels {
+			x := b.Samples[i]
+			y1 = x - x1 + r*y1
+			x1 = x
+			b.Samples[i] = y1
+		}
+	}
+}
+
+// Fade fades in the first frames and fades out the last frames. Fades that
+// are longer than the audio are shortened.
+func (b *Buffer) Fade(in int, out int) {
+	frames := b.Frames()
+	if in+out > frames {
+		in, out = in*frames/(in+out), out*frames/(in+out)
+	}
+	for i := 0; i < in; i++ {
+		b.frameGain(i, float64(i)/float64(in))
+	}
+	for i := 0; i < out; i++ {
+		b.frameGain(frames-1-i, float64(i)/float64(out))
+	}
+}
+
+func (b *Buffer) frameGain(frame int, gain float64) {
+	for c := 0; c < b.Channels; c++ {
+		b.Samples[frame*b.Channels+c] *= gain
+	}
+}
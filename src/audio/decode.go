@@ -0,0 +1,241 @@
+package audio
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+
+	log "github.com/schollz/logger"
+	"github.com/schollz/teoperator/src/aiff"
+	"github.com/schollz/teoperator/src/ffmpeg"
+)
+
+// Decode reads any audio file. WAV and AIFF files are decoded natively,
+// everything else is decoded by ffmpeg.
+func Decode(fname string) (b *Buffer, err error) {
+	return DecodeContext(context.Background(), fname)
+}
+
+// DecodeContext is Decode with a context that stops ffmpeg
+func DecodeContext(ctx context.Context, fname string) (b *Buffer, err error) {
+	return DecodeRange(ctx, fname, 0, 0)
+}
+
+// DecodeRange is DecodeContext for at most duration seconds from start
+// seconds on. Only the audio in the range is decoded, so long files do not
+// fill the memory. A duration of 0 decodes to the end.
+func DecodeRange(ctx context.Context, fname string, start float64, duration float64) (b *Buffer, err error) {
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".wav", ".aif", ".aiff", ".aifc":
+		var data []byte
+		data, err = ioutil.ReadFile(fname)
+		if err != nil {
+			return
+		}
+		b, err = decodeBytes(data, start, duration)
+		if err == nil {
+			return
+		}
+		log.Debugf("decoding %s with ffmpeg: %s", fname, err)
+	}
+	data, err := ffmpeg.DecodeRange(ctx, fname, start, duration)
+	if err != nil {
+		return
+	}
+	b, err = DecodeWAV(data)
+	return
+}
+
+// DecodeBytes decodes a WAV or AIFF file
+func DecodeBytes(data []byte) (b *Buffer, err error) {
+	return decodeBytes(data, 0, 0)
+}
+
+func decodeBytes(data []byte, start float64, duration float64) (b *Buffer, err error) {
+	if len(data) < 12 {
+		err = fmt.Errorf("not a wav or aiff file")
+		return
+	}
+	switch string(data[0:4]) {
+	case "RIFF":
+		return decodeWAV(data, start, duration)
+	case "FORM":
+		return decodeAIFF(data, start, duration)
+	}
+	err = fmt.Errorf("not a wav or aiff file")
+	return
+}
+
+// window returns the sound data of the frames from start seconds on, for
+// at most duration seconds or to the end if duration is 0
+func window(sound []byte, frameSize int, sampleRate int, start float64, duration float64) []byte {
+	if frameSize <= 0 {
+		return sound
+	}
+	frames := len(sound) / frameSize
+	first := int(math.Round(start * float64(sampleRate)))
+	if first > frames {
+		first = frames
+	}
+	last := frames
+	if duration > 0 && first+int(math.Round(duration*float64(sampleRate))) < last {
+		last = first + int(math.Round(duration*float64(sampleRate)))
+	}
+	return sound[first*frameSize : last*frameSize]
+}
+
+// DecodeWAV decodes integer or float wav data
+func DecodeWAV(data []byte) (b *Buffer, err error) {
+	return decodeWAV(data, 0, 0)
+}
+
+func decodeWAV(data []byte, start float64, duration float64) (b *Buffer, err error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		err = fmt.Errorf("not a wav file")
+		return
+	}
+	var format, bits int
+	b = &Buffer{}
+	for i := 12; i+8 <= len(data); {
+		id := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		i += 8
+		// streamed wavs do not know the size of their data
+		if size < 0 || i+size > len(data) || (id == "data" && size == 0) {
+			size = len(data) - i
+		}
+		chunk := data[i : i+size]
+		switch id {
+		case "fmt ":
+			if len(chunk) < 16 {
+				err = fmt.Errorf("wav format is too short")
+				return
+			}
+			format = int(binary.LittleEndian.Uint16(chunk[0:2]))
+			b.Channels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+			b.SampleRate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+			bits = int(binary.LittleEndian.Uint16(chunk[14:16]))
+			// extensible formats keep the format in the sub format
+			if format == 0xFFFE && len(chunk) >= 26 {
+				format = int(binary.LittleEndian.Uint16(chunk[24:26]))
+			}
+		case "data":
+			if b.Channels == 0 {
+				err = fmt.Errorf("wav data before format")
+				return
+			}
+			chunk = window(chunk, b.Channels*((bits+7)/8), b.SampleRate, start, duration)
+			switch {
+			case format == 1:
+				b.Samples, err = decodeInts(chunk, bits, binary.LittleEndian)
+			case format == 3:
+				b.Samples, err = decodeFloats(chunk, bits, binary.LittleEndian)
+			default:
+				err = fmt.Errorf("unsupported wav format %d", format)
+			}
+			return
+		}
+		i += size + size%2
+	}
+	err = fmt.Errorf("wav has no data")
+	return
+}
+
+// DecodeAIFF decodes uncompressed or float aiff data
+func DecodeAIFF(data []byte) (b *Buffer, err error) {
+	return decodeAIFF(data, 0, 0)
+}
+
+func decodeAIFF(data []byte, start float64, duration float64) (b *Buffer, err error) {
+	f, err := aiff.Decode(data)
+	if err != nil {
+		return
+	}
+	c, err := f.Common()
+	if err != nil {
+		return
+	}
+	s, err := f.SoundData()
+	if err != nil {
+		return
+	}
+	b = &Buffer{SampleRate: int(math.Round(c.SampleRate)), Channels: c.Channels}
+	sound := s.Data
+	if frames := int(c.SampleFrames) * c.Channels * ((c.SampleSize + 7) / 8); frames < len(sound) {
+		sound = sound[:frames]
+	}
+	frameSize := c.Channels * ((c.SampleSize + 7) / 8)
+	switch c.Compression {
+	case "fl32", "FL32":
+		frameSize = c.Channels * 4
+	case "fl64", "FL64":
+		frameSize = c.Channels * 8
+	}
+	sound = window(sound, frameSize, b.SampleRate, start, duration)
+	switch c.Compression {
+	case "", "NONE", "twos":
+		b.Samples, err = decodeInts(sound, c.SampleSize, binary.BigEndian)
+	case "sowt":
+		b.Samples, err = decodeInts(sound, c.SampleSize, binary.LittleEndian)
+	case "fl32", "FL32":
+		b.Samples, err = decodeFloats(sound, 32, binary.BigEndian)
+	case "fl64", "FL64":
+		b.Samples, err = decodeFloats(sound, 64, binary.BigEndian)
+	default:
+		err = fmt.Errorf("unsupported aiff compression '%s'", c.Compression)
+	}
+	return
+}
+
+// decodeInts decodes signed integers, except for 8-bit wavs which are unsigned
+func decodeInts(data []byte, bits int, order binary.ByteOrder) (samples []float64, err error) {
+	bytes := (bits + 7) / 8
+	if bytes < 1 || bytes > 4 {
+		err = fmt.Errorf("unsupported sample size %d", bits)
+		return
+	}
+	samples = make([]float64, len(data)/bytes)
+	scale := math.Pow(2, float64(8*bytes-1))
+	for i := range samples {
+		b := data[i*bytes : (i+1)*bytes]
+		var v int32
+		if order == binary.BigEndian {
+			for _, x := range b {
+				v = v<<8 | int32(x)
+			}
+		} else {
+			for j := len(b) - 1; j >= 0; j-- {
+				v = v<<8 | int32(b[j])
+			}
+		}
+		// sign extend
+		v = v << (32 - 8*bytes) >> (32 - 8*bytes)
+		if bytes == 1 && order == binary.LittleEndian {
+			v = int32(b[0]) - 128
+		}
+		samples[i] = float64(v) / scale
+	}
+	return
+}
+
+func decodeFloats(data []byte, bits int, order binary.ByteOrder) (samples []float64, err error) {
+	switch bits {
+	case 32:
+		samples = make([]float64, len(data)/4)
+		for i := range samples {
+			samples[i] = float64(math.Float32frombits(order.Uint32(data[i*4:])))
+		}
+	case 64:
+		samples = make([]float64, len(data)/8)
+		for i := range samples {
+			samples[i] = math.Float64frombits(order.Uint64(data[i*8:]))
+		}
+	default:
+		err = fmt.Errorf("unsupported float size %d", bits)
+	}
+	return
+}
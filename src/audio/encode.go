@@ -0,0 +1,52 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+
+	"github.com/schollz/teoperator/src/aiff"
+)
+
+// AIFF returns the audio as a 16-bit aiff file
+func (b *Buffer) AIFF() (f aiff.File) {
+	f.Type = "AIFF"
+	f.SetCommon(aiff.Common{
+		Channels:     b.Channels,
+		SampleFrames: uint32(b.Frames()),
+		SampleSize:   16,
+		SampleRate:   float64(b.SampleRate),
+	})
+	f.SetSoundData(aiff.SoundData{Data: b.pcm16(binary.BigEndian)})
+	return
+}
+
+// WriteWAV writes the audio as a 16-bit wav file
+func (b *Buffer) WriteWAV(fname string) (err error) {
+	data := b.pcm16(binary.LittleEndian)
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+len(data)))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], uint16(b.Channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(b.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(b.SampleRate*b.Channels*2))
+	binary.LittleEndian.PutUint16(header[32:], uint16(b.Channels*2))
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(data)))
+	err = ioutil.WriteFile(fname, append(header, data...), 0644)
+	return
+}
+
+// pcm16 returns the samples as clipped 16-bit integers
+func (b *Buffer) pcm16(order binary.ByteOrder) (data []byte) {
+	data = make([]byte, 2*len(b.Samples))
+	for i, x := range b.Samples {
+		v := math.Round(math.Max(-1, math.Min(1, x)) * 32767)
+		order.PutUint16(data[2*i:], uint16(int16(v)))
+	}
+	return
+}
@@ -0,0 +1,118 @@
+package audio
+
+import "math"
+
+// Loudness returns the integrated loudness in LUFS as defined by ITU-R
+// BS.1770, which is -Inf for silence
+func (b *Buffer) Loudness() float64 {
+	if b.Frames() == 0 {
+		return math.Inf(-1)
+	}
+	weighted := b.kWeighted()
+
+	// mean square of 400 ms blocks that overlap by 75%
+	block := int(0.4 * float64(b.SampleRate))
+	step := block / 4
+	if block > b.Frames() || step == 0 {
+		block = b.Frames()
+		step = block
+	}
+	var powers []float64
+	for start := 0; start+block <= b.Frames(); start += step {
+		power := 0.0
+		for _, x := range weighted.Samples[start*b.Channels : (start+block)*b.Channels] {
+			power += x * x
+		}
+		powers = append(powers, power/float64(block))
+	}
+
+	// gate absolute silence, and then everything 10 LU below the rest
+	gated := gate(powers, lufsPower(-70))
+	if len(gated) == 0 {
+		return math.Inf(-1)
+	}
+	gated = gate(gated, mean(gated)*lufsPower(-10)/lufsPower(0))
+	return powerLUFS(mean(gated))
+}
+
+// kWeighted returns the audio through the BS.1770 pre-filter, a high shelf
+// and a high pass
+func (b *Buffer) kWeighted() *Buffer {
+	shelf := highShelf(float64(b.SampleRate), 1681.974450955533, 0.7071752369554196, 3.999843853973347)
+	highpass := highPass(float64(b.SampleRate), 38.13547087602444, 0.5003270373238773)
+	b2 := b.Copy()
+	for c := 0; c < b.Channels; c++ {
+		var s1, s2 biquadState
+		for i := c; i < len(b2.Samples); i += b.Channels {
+			b2.Samples[i] = highpass.process(&s2, shelf.process(&s1, b2.Samples[i]))
+		}
+	}
+	return b2
+}
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+type biquadState struct {
+	x1, x2, y1, y2 float64
+}
+
+func (f biquad) process(s *biquadState, x float64) (y float64) {
+	y = f.b0*x + f.b1*s.x1 + f.b2*s.x2 - f.a1*s.y1 - f.a2*s.y2
+	s.x2, s.x1 = s.x1, x
+	s.y2, s.y1 = s.y1, y
+	return
+}
+
+// highShelf and highPass are the filters of libebur128, designed for any
+// sample rate to match the coefficients of BS.1770 at 48 khz
+func highShelf(sampleRate, frequency, q, db float64) biquad {
+	k := math.Tan(math.Pi * frequency / sampleRate)
+	vh := math.Pow(10, db/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	return biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+}
+
+func highPass(sampleRate, frequency, q float64) biquad {
+	k := math.Tan(math.Pi * frequency / sampleRate)
+	a0 := 1 + k/q + k*k
+	return biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+}
+
+func gate(powers []float64, threshold float64) (gated []float64) {
+	for _, p := range powers {
+		if p > threshold {
+			gated = append(gated, p)
+		}
+	}
+	return
+}
+
+func mean(values []float64) (m float64) {
+	for _, v := range values {
+		m += v
+	}
+	return m / float64(len(values))
+}
+
+func lufsPower(lufs float64) float64 {
+	return math.Pow(10, (lufs+0.691)/10)
+}
+
+func powerLUFS(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
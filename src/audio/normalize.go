@@ -0,0 +1,164 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// normalization modes
+const (
+	// None keeps the level
+	None = "none"
+	// Peak sets the loudest sample, in dBFS
+	Peak = "peak"
+	// RMS sets the average level, in dBFS
+	RMS = "rms"
+	// LUFS sets the perceived loudness of EBU R128
+	LUFS = "lufs"
+)
+
+// NormalizeModes are all normalization modes
+var NormalizeModes = []string{None, Peak, RMS, LUFS}
+
+// targets of each mode if none is given
+var defaultTargets = map[string]float64{
+	Peak: -1,
+	RMS:  -20,
+	LUFS: -23,
+}
+
+// defaultCeiling is the highest peak in dBFS when normalizing the rms or
+// loudness
+const defaultCeiling = -2
+
+// Normalization sets the level of audio
+type Normalization struct {
+	// Mode is None, Peak, RMS or LUFS
+	Mode string
+	// Target is the level in dBFS, or LUFS for loudness
+	Target float64
+	// Ceiling is the highest peak in dBFS for RMS and LUFS
+	Ceiling float64
+	// PerSlice levels each slice of a drum patch on its own
+	PerSlice bool
+}
+
+// DefaultNormalization is the EBU R128 loudness used for synth samples
+var DefaultNormalization = Normalization{Mode: LUFS, Target: -23, Ceiling: defaultCeiling}
+
+// ParseNormalization parses a mode with an optional target, like "peak"
+// or "lufs:-14"
+func ParseNormalization(s string) (n Normalization, err error) {
+	parts := strings.SplitN(strings.ToLower(strings.TrimSpace(s)), ":", 2)
+	n.Mode = parts[0]
+	if n.Mode == "" {
+		n.Mode = None
+	}
+	n.Ceiling = defaultCeiling
+	target, ok := defaultTargets[n.Mode]
+	if !ok && n.Mode != None {
+		err = fmt.Errorf("unknown normalization '%s', use one of %+v", n.Mode, NormalizeModes)
+		return
+	}
+	n.Target = target
+	if len(parts) == 2 {
+		if n.Mode == None {
+			err = fmt.Errorf("normalization 'none' has no target")
+			return
+		}
+		n.Target, err = strconv.ParseFloat(parts[1], 64)
+		if err != nil || n.Target > 0 {
+			err = fmt.Errorf("bad target '%s' for %s, use a level like -14", parts[1], n.Mode)
+			return
+		}
+	}
+	return
+}
+
+func (n Normalization) String() string {
+	if n.Mode == "" || n.Mode == None {
+		return None
+	}
+	s := fmt.Sprintf("%s:%g", n.Mode, n.Target)
+	if n.PerSlice {
+		s += " per slice"
+	}
+	return s
+}
+
+// Apply changes the level of the audio and returns the gain in decibels
+func (n Normalization) Apply(b *Buffer) (gain float64) {
+	var level float64
+	switch n.Mode {
+	case Peak:
+		level = b.Peak()
+	case RMS:
+		level = b.RMS()
+	case LUFS:
+		level = b.Loudness()
+	default:
+		return 0
+	}
+	if math.IsInf(level, -1) {
+		return 0
+	}
+	gain = n.Target - level
+	if n.Mode != Peak {
+		if peak := b.Peak(); peak+gain > n.Ceiling {
+			gain = n.Ceiling - peak
+		}
+	}
+	b.Gain(gain)
+	return
+}
+
+// ApplySlices changes the level of each slice between start and end
+// frames. Overlapping slices end where the next one starts, so no audio
+// is changed twice.
+func (n Normalization) ApplySlices(b *Buffer, starts []int, ends []int) (gains []float64) {
+	for _, r := range b.regions(starts, ends) {
+		gains = append(gains, n.Apply(r))
+	}
+	return
+}
+
+// regions returns the audio between start and end frames, sharing the
+// samples of the buffer. Slices that start together are returned once and
+// each slice ends where the next one starts.
+func (b *Buffer) regions(starts []int, ends []int) (regions []*Buffer) {
+	type slice struct{ start, end int }
+	var slices []slice
+	for i := range starts {
+		start, end := starts[i], ends[i]
+		if end > b.Frames() {
+			end = b.Frames()
+		}
+		if start < 0 || start >= end {
+			continue
+		}
+		slices = append(slices, slice{start, end})
+	}
+	// keys that play the same slice are changed once
+	sort.Slice(slices, func(i, j int) bool {
+		if slices[i].start == slices[j].start {
+			return slices[i].end > slices[j].end
+		}
+		return slices[i].start < slices[j].start
+	})
+	var unique []slice
+	for i, s := range slices {
+		if i == 0 || s.start != slices[i-1].start {
+			unique = append(unique, s)
+		}
+	}
+	for i, s := range unique {
+		if i < len(unique)-1 && unique[i+1].start < s.end {
+			s.end = unique[i+1].start
+		}
+		regions = append(regions, &Buffer{SampleRate: b.SampleRate, Channels: b.Channels, Samples: b.Samples[s.start*b.Channels : s.end*b.Channels]})
+	}
+	return
+}
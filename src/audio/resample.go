@@ -0,0 +1,62 @@
+package audio
+
+import "math"
+
+// taps on each side of the resampling filter
+const resampleTaps = 16
+
+// Resample returns the audio at another sample rate, using a windowed sinc
+// filter that also removes frequencies above the new nyquist frequency
+func (b *Buffer) Resample(sampleRate int) *Buffer {
+	if sampleRate == b.SampleRate || b.SampleRate == 0 {
+		b2 := b.Copy()
+		b2.SampleRate = sampleRate
+		return b2
+	}
+	ratio := float64(sampleRate) / float64(b.SampleRate)
+	cutoff := math.Min(1, ratio)
+	width := int(math.Ceil(resampleTaps / cutoff))
+	frames := b.Frames()
+	frames2 := int(math.Floor(float64(frames) * ratio))
+	b2 := &Buffer{SampleRate: sampleRate, Channels: b.Channels, Samples: make([]float64, frames2*b.Channels)}
+
+	weights := make([]float64, 2*width+1)
+	for i := 0; i < frames2; i++ {
+		t := float64(i) / ratio
+		center := int(math.Floor(t))
+		sum := 0.0
+		for k := range weights {
+			j := center - width + k
+			x := t - float64(j)
+			weights[k] = cutoff * sinc(cutoff*x) * blackman(x/float64(width+1))
+			sum += weights[k]
+		}
+		for c := 0; c < b.Channels; c++ {
+			value := 0.0
+			for k, w := range weights {
+				j := center - width + k
+				if j >= 0 && j < frames {
+					value += w * b.Samples[j*b.Channels+c]
+				}
+			}
+			// keep a constant level at dc
+			b2.Samples[i*b.Channels+c] = value / sum
+		}
+	}
+	return b2
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman is a window that is 1 at 0 and 0 at -1 and 1
+func blackman(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+}
@@ -1,21 +1,23 @@
 package audiosegment
 
 import (
+	"context"
 	"fmt"
 	"image"
 	_ "image/png"
 	"math"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
-	"strconv"
+	"time"
 
 	"github.com/schollz/logger"
-	"github.com/schollz/teoperator/src/aubio"
+	"github.com/schollz/teoperator/src/audio"
+	"github.com/schollz/teoperator/src/command"
 	"github.com/schollz/teoperator/src/ffmpeg"
 	"github.com/schollz/teoperator/src/models"
+	"github.com/schollz/teoperator/src/onset"
 	"github.com/schollz/teoperator/src/op1"
 	"github.com/schollz/teoperator/src/utils"
 )
@@ -30,34 +32,23 @@ func init() {
 
 const SECONDSATEND = 0.1
 
-func SplitEqual(fname string, secondsMax float64, secondsOverlap float64, splices int) (allSegments [][]models.AudioSegment, err error) {
-	err = Convert(fname, fname+".wav")
+// drawTimeout is the timeout of each program that draws a waveform
+const drawTimeout = time.Minute
+
+func SplitEqual(ctx context.Context, fname string, secondsMax float64, secondsOverlap float64, splices int, keys []string, device op1.Device, onsetOpts onset.Options, zeroCrossing float64, normalization audio.Normalization, declick audio.Declick) (allSegments [][]models.AudioSegment, err error) {
+	b, err := audio.DecodeContext(ctx, fname)
 	if err != nil {
 		return
 	}
-	fname = fname + ".wav"
+	b = b.Resample(44100)
 
 	if splices > 0 {
 		secondsOverlap = 0
 	}
 
-	cmd := []string{fname}
-	logger.Debug(cmd)
-	out, err := exec.Command("ffprobe", cmd...).CombinedOutput()
-	if err != nil {
-		logger.Debugf("%s", out)
-		return
-	}
-	secondsDuration, err := utils.ConvertToSeconds(utils.GetStringInBetween(string(out), "Duration: ", ","))
-	if err != nil {
-		logger.Debugf("%s", out)
-		logger.Debug(err)
-		return
-	}
-	secondsStart, _ := strconv.ParseFloat(utils.GetStringInBetween(string(out), "start: ", ","), 64)
-
+	secondsDuration := b.Duration()
 	secondStart := []float64{}
-	for i := secondsStart; i < secondsDuration+secondsStart; i += secondsMax - secondsOverlap {
+	for i := 0.0; i < secondsDuration; i += secondsMax - secondsOverlap {
 		secondStart = append(secondStart, i)
 	}
 
@@ -78,10 +69,15 @@ func SplitEqual(fname string, secondsMax float64, secondsOverlap float64, splice
 			for j := range jobs {
 				// step 3: specify the work for the worker
 				var r result
+				if r.err = ctx.Err(); r.err != nil {
+					results <- r
+					continue
+				}
 				folder, filenameonly := filepath.Split(fname)
 				fnameTrunc := path.Join(folder, fmt.Sprintf("%s%03d.wav", filenameonly[:3], int(j.start)))
 				fnameTruncOP1 := path.Join(folder, fmt.Sprintf("%s%03d.aif", filenameonly[:3], int(j.start)))
-				r.err = Truncate(fname, fnameTrunc, utils.SecondsToString(j.start), utils.SecondsToString(j.start+secondsMax))
+				chunk := b.Trim(j.start, j.start+secondsMax)
+				r.err = chunk.WriteWAV(fnameTrunc)
 				if r.err != nil {
 					logger.Error(r.err)
 					results <- r
@@ -89,11 +85,14 @@ func SplitEqual(fname string, secondsMax float64, secondsOverlap float64, splice
 				}
 
 				if splices == 0 {
-					logger.Debug("-- splitting on silence --")
-					r.segments, r.err = aubio.SplitOnSilence(fnameTrunc, -22, 0.2, -0.2)
+					logger.Debug("-- splitting on onsets --")
+					r.segments, r.err = onset.Segments(chunk, onsetOpts)
+					for i := range r.segments {
+						r.segments[i].Filename = fnameTrunc
+					}
 					if r.err != nil || len(r.segments) > 20 {
 						logger.Debug("-- splitting on silence w/ ffmpeg --")
-						r.segments, r.err = ffmpeg.SplitOnSilence(fnameTrunc, -22, 0.2, -0.2)
+						r.segments, r.err = ffmpeg.SplitOnSilence(ctx, fnameTrunc, -22, 0.2, -0.2)
 						if r.err != nil {
 							logger.Error(r.err)
 							results <- r
@@ -102,14 +101,14 @@ func SplitEqual(fname string, secondsMax float64, secondsOverlap float64, splice
 					}
 				} else {
 					r.segments = make([]models.AudioSegment, splices)
-					for i, _ := range r.segments {
-						r.segments[i].Start = secondsDuration * float64(i) / float64(splices)
-						r.segments[i].End = secondsDuration * float64(i+1) / float64(splices)
+					for i := range r.segments {
+						r.segments[i].Start = chunk.Duration() * float64(i) / float64(splices)
+						r.segments[i].End = chunk.Duration() * float64(i+1) / float64(splices)
 						r.segments[i].Duration = r.segments[i].End - r.segments[i].Start
 						r.segments[i].Filename = fnameTrunc
 					}
 				}
-				r.err = DrawSegments(r.segments)
+				r.err = DrawSegments(ctx, r.segments)
 				if r.err != nil {
 					logger.Error(r.err)
 					results <- r
@@ -118,12 +117,15 @@ func SplitEqual(fname string, secondsMax float64, secondsOverlap float64, splice
 
 				// generate op-1 stuff
 				op1data := op1.NewDrumPatch()
+				op1data.SetDevice(device)
+				op1data.Normalization = normalization
+				var setKeys []int
 				for i, seg := range r.segments {
 					r.segments[i].StartAbs = j.start
 					r.segments[i].EndAbs = j.start + secondsMax
 					if i < len(op1data.End)-2 {
-						start := int64(math.Floor(math.Round(seg.Start*100) * 441 * 4058))
-						end := int64(math.Floor(math.Round(seg.End*100) * 441 * 4058))
+						start := int64(math.Floor(math.Round(seg.Start*100)*float64(device.SampleRate)/100)) * device.SampleConversion
+						end := int64(math.Floor(math.Round(seg.End*100)*float64(device.SampleRate)/100)) * device.SampleConversion
 						if start > end {
 							continue
 						}
@@ -134,15 +136,30 @@ func SplitEqual(fname string, secondsMax float64, secondsOverlap float64, splice
 						logger.Debug(seg.End, end)
 						op1data.Start[i] = start
 						op1data.End[i] = end
+						setKeys = append(setKeys, i)
 					}
 				}
 
-				// write as op1 data
-				r.err = op1data.Save(fnameTrunc, fnameTruncOP1)
+				// move slice points to zero crossings so they do not click
+				chunk = chunk.Convert(device.SampleRate, device.Channels, device.DrumSeconds)
+				if zeroCrossing > 0 {
+					op1data.SnapToZeroCrossings(chunk.Mono(), int(zeroCrossing*float64(device.SampleRate)))
+				}
+				op1data.Declick(chunk, declick, setKeys)
+				op1data.Normalize(chunk, setKeys)
+
+				r.err = op1data.EditKeys(keys...)
 				if r.err != nil {
 					logger.Error(r.err)
+					results <- r
 					continue
 				}
+
+				// write as op1 data
+				r.err = op1data.SaveBuffer(chunk, fnameTruncOP1)
+				if r.err != nil {
+					logger.Error(r.err)
+				}
 				results <- r
 			}
 		}(jobs, results)
@@ -158,11 +175,12 @@ func SplitEqual(fname string, secondsMax float64, secondsOverlap float64, splice
 	for i := 0; i < numJobs; i++ {
 		r := <-results
 		if r.err != nil {
-			logger.Error(err)
+			logger.Error(r.err)
 			continue
 		}
 		allSegments = append(allSegments, r.segments)
 	}
+	err = ctx.Err()
 
 	return
 }
@@ -175,7 +193,7 @@ func SplitEqual(fname string, secondsMax float64, secondsOverlap float64, splice
 // composite lifeb.png canvas.gif -compose Dst_In 3.png
 // convert 3.png -fuzz 1% -transparent black 4.png
 // eog 4.png
-func DrawSegments(segments []models.AudioSegment) (err error) {
+func DrawSegments(ctx context.Context, segments []models.AudioSegment) (err error) {
 	if len(segments) == 0 {
 		err = fmt.Errorf("no segments")
 		return
@@ -184,10 +202,12 @@ func DrawSegments(segments []models.AudioSegment) (err error) {
 	defer os.Remove(wave)
 	cmd := []string{"-i", segments[0].Filename, "-o", wave, "--background-color", "ffffff00", "--waveform-color", "000000", "--amplitude-scale", "2", "--no-axis-labels", "--pixels-per-second", "100", "--height", "160", "--width",
 		fmt.Sprintf("%2.0f", (segments[len(segments)-1].End-segments[0].Start)*100)}
-	logger.Debug(cmd)
-	out, err := exec.Command("audiowaveform", cmd...).CombinedOutput()
+	_, _, err = command.Run(ctx, drawTimeout, "audiowaveform", cmd...)
 	if err != nil {
-		logger.Errorf("audiowaveform: %s", out)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error(err)
 	}
 
 	colors := []string{"#EEEEEE", "#343434"}
@@ -201,10 +221,12 @@ func DrawSegments(segments []models.AudioSegment) (err error) {
 			fmt.Sprintf("%2.0fx160", segments[i].Duration*100),
 			fmt.Sprintf("canvas:%s", colors[int(math.Mod(float64(i), 2))]),
 			canvasName}
-		logger.Debug(cmd)
-		out, err = exec.Command(imagemagickconvert, cmd...).CombinedOutput()
+		_, _, err = command.Run(ctx, drawTimeout, imagemagickconvert, cmd...)
 		if err != nil {
-			logger.Errorf("audiowaveform: %s", out)
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error(err)
 		}
 	}
 
@@ -212,10 +234,12 @@ func DrawSegments(segments []models.AudioSegment) (err error) {
 	finalCanvas := utils.TempFileName("final", ".png")
 	defer os.Remove(finalCanvas)
 	cmd = append(canvases, "+append", finalCanvas)
-	logger.Debug(cmd)
-	out, err = exec.Command(imagemagickconvert, cmd...).CombinedOutput()
+	_, _, err = command.Run(ctx, drawTimeout, imagemagickconvert, cmd...)
 	if err != nil {
-		logger.Errorf("convert: %s", out)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error(err)
 	}
 
 	// crop final canvas (not sure why this is nessecary)
@@ -225,27 +249,33 @@ func DrawSegments(segments []models.AudioSegment) (err error) {
 	cmd = []string{
 		finalCanvas, "-crop", fmt.Sprintf("%dx%d+0+0", width, height), finalCanvasResized,
 	}
-	logger.Debug(cmd)
-	out, err = exec.Command(imagemagickconvert, cmd...).CombinedOutput()
+	_, _, err = command.Run(ctx, drawTimeout, imagemagickconvert, cmd...)
 	if err != nil {
-		logger.Errorf("convert: %s", out)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error(err)
 	}
 
 	composite := utils.TempFileName("composite", ".png")
 	defer os.Remove(composite)
 	cmd = []string{wave, finalCanvasResized, "-compose", "Dst_In", composite}
-	logger.Debug(cmd)
-	out, err = exec.Command("composite", cmd...).CombinedOutput()
+	_, _, err = command.Run(ctx, drawTimeout, "composite", cmd...)
 	if err != nil {
-		logger.Errorf("composite: %s", out)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error(err)
 	}
 
 	final := segments[0].Filename + ".png"
 	cmd = []string{composite, "-fuzz", "1%", "-transparent", "black", final}
-	logger.Debug(cmd)
-	out, err = exec.Command(imagemagickconvert, cmd...).CombinedOutput()
+	_, _, err = command.Run(ctx, drawTimeout, imagemagickconvert, cmd...)
 	if err != nil {
-		logger.Errorf("convert: %s", out)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error(err)
 	}
 
 	return
@@ -393,29 +423,3 @@ func getImageDimension(imagePath string) (int, int) {
 // 	err = waveform.Image(segment.Filename, "ffffff", segment.Duration)
 // 	return
 // }
-
-// Truncate will truncate a file, while converting it to 44100
-func Truncate(fnameIn, fnameOut, from, to string) (err error) {
-	cmd := []string{"-y", "-i", fnameIn, "-c", "copy", "-ss", from, "-to", to, fnameOut}
-	logger.Debug(cmd)
-	out, err := exec.Command("ffmpeg", cmd...).CombinedOutput()
-	logger.Debugf("ffmpeg: %s", out)
-	if err != nil {
-		err = fmt.Errorf("ffmpeg; %s", err.Error())
-		return
-	}
-	return
-}
-
-// Convert will convert a file to
-func Convert(fnameIn, fnameOut string) (err error) {
-	cmd := []string{"-y", "-i", fnameIn, "-ar", "44100", fnameOut}
-	logger.Debug(cmd)
-	out, err := exec.Command("ffmpeg", cmd...).CombinedOutput()
-	logger.Debugf("ffmpeg: %s", out)
-	if err != nil {
-		err = fmt.Errorf("ffmpeg; %s", err.Error())
-		return
-	}
-	return
-}
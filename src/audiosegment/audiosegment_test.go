@@ -1,9 +1,13 @@
 package audiosegment
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
+	"github.com/schollz/teoperator/src/audio"
+	"github.com/schollz/teoperator/src/onset"
+	"github.com/schollz/teoperator/src/op1"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -53,7 +57,7 @@ import (
 // }
 
 func TestSplitEqual(t *testing.T) {
-	segments, err := SplitEqual("tests/creeley.mp3", 11.5, 1)
+	segments, err := SplitEqual(context.Background(), "tests/creeley.mp3", 11.5, 1, 0, nil, op1.OP1, onset.DefaultOptions, 0.005, audio.Normalization{}, audio.DefaultDeclick)
 	assert.Nil(t, err)
 	fmt.Println(segments)
 }
@@ -0,0 +1,75 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	log "github.com/schollz/logger"
+)
+
+// tailBytes is how much of the end of stderr is kept in an Error
+const tailBytes = 2048
+
+// Error is a command that failed, was cancelled or timed out
+type Error struct {
+	Name string
+	Args []string
+	// Err is the exit error, or the error of the context
+	Err error
+	// Stderr is the end of what the command wrote to stderr
+	Stderr string
+}
+
+func (e *Error) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s: %s", e.Name, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Name, e.Err, e.Stderr)
+}
+
+// Unwrap returns the underlying error, like context.DeadlineExceeded
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Run runs a program and returns its stdout and stderr. The program is
+// killed when the context is cancelled or after the timeout, if it is
+// not 0.
+func Run(ctx context.Context, timeout time.Duration, name string, args ...string) (stdout []byte, stderr []byte, err error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	log.Debug(append([]string{name}, args...))
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	err = cmd.Run()
+	stdout, stderr = outBuf.Bytes(), errBuf.Bytes()
+	if err != nil {
+		// the error of a killed program is less useful than the reason
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		err = &Error{Name: name, Args: args, Err: err, Stderr: tail(stderr)}
+		log.Debug(err)
+	}
+	return
+}
+
+// tail returns the last lines of output, at most tailBytes long
+func tail(b []byte) string {
+	if len(b) > tailBytes {
+		b = b[len(b)-tailBytes:]
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			b = b[i+1:]
+		}
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,44 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	stdout, stderr, err := Run(context.Background(), time.Second, "sh", "-c", "echo out; echo err >&2")
+	assert.Nil(t, err)
+	assert.Equal(t, "out\n", string(stdout))
+	assert.Equal(t, "err\n", string(stderr))
+
+	_, _, err = Run(context.Background(), time.Second, "sh", "-c", "echo something went wrong >&2; exit 3")
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, "sh", e.Name)
+	assert.Equal(t, "something went wrong", e.Stderr)
+	assert.Contains(t, err.Error(), "exit status 3")
+}
+
+func TestRunTimeout(t *testing.T) {
+	start := time.Now()
+	_, _, err := Run(context.Background(), 100*time.Millisecond, "sleep", "10")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start).Seconds(), 5.0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = Run(ctx, 0, "sleep", "10")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestTail(t *testing.T) {
+	long := strings.Repeat("line\n", 1000) + "last"
+	assert.True(t, strings.HasSuffix(tail([]byte(long)), "line\nlast"))
+	assert.LessOrEqual(t, len(tail([]byte(long))), tailBytes)
+	assert.True(t, strings.HasPrefix(tail([]byte(long)), "line"))
+}
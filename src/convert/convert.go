@@ -1,64 +1,228 @@
 package convert
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"math"
-	"os"
-	"path/filepath"
-	"strings"
 
 	log "github.com/schollz/logger"
+	"github.com/schollz/teoperator/src/audio"
 	"github.com/schollz/teoperator/src/ffmpeg"
+	"github.com/schollz/teoperator/src/onset"
 	"github.com/schollz/teoperator/src/op1"
+	"github.com/schollz/teoperator/src/pitch"
+	"github.com/schollz/teoperator/src/tempo"
 )
 
-func newName(fname string) (fname2 string) {
-	fname2 = strings.TrimSuffix(fname, filepath.Ext(fname)) + "_patch.aif"
-	if _, err := os.Stat(fname2); os.IsNotExist(err) {
-		// does not exist
+// Options are the settings for converting files into patches
+type Options struct {
+	// Device is the target device, the op-1 if not set
+	Device op1.Device
+	// Slices is the number of even slices for a single drum file,
+	// 0 slices at the onsets
+	Slices int
+	// Onset tunes the onset detection, the defaults if empty
+	Onset onset.Options
+	// Grid slices a single drum file on the beat grid, like "1/16",
+	// at the BPM or the detected tempo if 0
+	Grid string
+	BPM  float64
+	// ZeroCrossing is the seconds searched around each slice point for a
+	// zero crossing, 0 keeps the slice points as they are
+	ZeroCrossing float64
+	// Keys are key settings for drum patches, like "5:reverse,pitch=3"
+	Keys []string
+	// BaseFreq is the frequency of sampler patches, detected if 0
+	BaseFreq float64
+	// Normalization levels the patches, see op1.DrumPatch and
+	// op1.SynthPatch for the defaults
+	Normalization audio.Normalization
+	// Declick fades the slices of drum patches, removes their offset and
+	// puts gaps between joined files, nothing if empty
+	Declick audio.Declick
+
+	// OutDir is the folder for the patches, next to the input if empty
+	OutDir string
+	// Template is the name of the patches, see DefaultTemplate
+	Template string
+	// Collision is what to do with existing patches: "increment" (default),
+	// "overwrite" or "skip"
+	Collision string
+}
+
+func (opts Options) device() op1.Device {
+	if opts.Device.Name == "" {
+		return op1.OP1
+	}
+	return opts.Device
+}
+
+// snap moves the slice points of a drum patch to zero crossings of audio
+// at the sample rate of the device
+func (opts Options) snap(dp *op1.DrumPatch, b *audio.Buffer) {
+	if opts.ZeroCrossing <= 0 {
 		return
 	}
-	for i := 2; i < 100; i++ {
-		fname2 = strings.TrimSuffix(fname, filepath.Ext(fname)) + fmt.Sprintf("_patch%d.aif", i)
-		if _, err := os.Stat(fname2); os.IsNotExist(err) {
-			// does not exist
-			return
-		}
+	dp.SnapToZeroCrossings(b.Mono(), int(opts.ZeroCrossing*float64(b.SampleRate)))
+}
 
+// decode reads a file for a drum patch of the device, without decoding more
+// than fits. Files that are longer than a drum patch are an error, they are
+// never cut.
+func (opts Options) decode(ctx context.Context, fname string) (b *audio.Buffer, err error) {
+	device := opts.device()
+	maxSeconds := float64(device.MaxDrumSamples()) / float64(device.SampleRate)
+	// a second more tells whether the file is too long
+	b, err = audio.DecodeRange(ctx, fname, 0, maxSeconds+1)
+	if err != nil {
+		return
+	}
+	b = b.Convert(device.SampleRate, device.Channels, 0)
+	if int64(b.Frames()) > device.MaxDrumSamples() {
+		err = fmt.Errorf("%s is longer than the %2.3f seconds of a drum patch for the %s, cut it first", fname, maxSeconds, device.Name)
 	}
 	return
 }
 
-func ToSynth(fname string, baseFreq float64) (err error) {
+// secondsToPosition converts seconds into drum patch start/end units
+func secondsToPosition(seconds float64, device op1.Device) int64 {
+	return int64(math.Floor(math.Round(seconds*100)*float64(device.SampleRate)/100)) * device.SampleConversion
+}
+
+func ToSynth(ctx context.Context, fname string, opts Options) (err error) {
 	log.Debug(fname)
-	finalName := newName(fname)
+	finalName, skip, err := opts.outputName(fname, "synth", 1, 1, 0)
+	if err != nil || skip {
+		if skip {
+			fmt.Printf("skipped %s, %s exists\n", fname, finalName)
+		}
+		return
+	}
+	b, err := audio.DecodeRange(ctx, fname, 0, opts.device().SynthSeconds)
+	if err != nil {
+		return
+	}
+	baseFreq := opts.BaseFreq
+	if baseFreq <= 0 {
+		baseFreq = detectBaseFreq(fname, b)
+	}
 	synthPatch := op1.NewSynthSamplePatch(baseFreq)
-	err = synthPatch.SaveSample(fname, finalName, false)
+	synthPatch.SetDevice(opts.device())
+	synthPatch.Normalization = opts.Normalization
+	err = synthPatch.SaveSampleBuffer(b, finalName, false)
 	if err == nil {
 		fmt.Printf("converted %+v -> %s\n", fname, finalName)
 	}
 	return
 }
 
-func ToDrumSplice(fname string, slices int) (err error) {
-	finalName := newName(fname)
-	fname2, err := ffmpeg.ToMono(fname)
-	defer os.Remove(fname2)
+// DetectBaseFreq returns the root pitch of a file, or FallbackFreq if it
+// cannot be detected with confidence
+func DetectBaseFreq(ctx context.Context, fname string) (baseFreq float64) {
+	b, err := audio.DecodeContext(ctx, fname)
 	if err != nil {
+		log.Warnf("%s: %s, using %2.0f hz", fname, err.Error(), float64(FallbackFreq))
+		return FallbackFreq
+	}
+	return detectBaseFreq(fname, b)
+}
+
+// FallbackFreq is the base frequency of synth samples whose pitch is not
+// detected
+const FallbackFreq = 440
+
+// DetectBufferBaseFreq detects the base frequency and note of decoded audio.
+// If the pitch is not detected confidently it returns FallbackFreq with an
+// error.
+func DetectBufferBaseFreq(b *audio.Buffer) (baseFreq float64, note string, err error) {
+	baseFreq = FallbackFreq
+	r, err := pitch.DetectBuffer(b)
+	if err != nil {
+		return
+	}
+	if r.Confidence < pitch.MinConfidence {
+		err = fmt.Errorf("unsure about %s", r)
 		return
 	}
+	return r.Frequency, r.String(), nil
+}
+
+func detectBaseFreq(fname string, b *audio.Buffer) float64 {
+	baseFreq, note, err := DetectBufferBaseFreq(b)
+	if err != nil {
+		log.Warnf("%s: %s, using %2.0f hz", fname, err.Error(), baseFreq)
+		return baseFreq
+	}
+	fmt.Printf("detected %s in %s\n", note, fname)
+	return baseFreq
+}
+
+func ToDrumSplice(ctx context.Context, fname string, opts Options) (err error) {
+	device := opts.device()
+	if opts.Slices > device.Keys {
+		err = fmt.Errorf("%d slices do not fit on the %d keys of the %s", opts.Slices, device.Keys, device.Name)
+		return
+	}
+	var beatsPerSlice float64
+	if opts.Grid != "" {
+		beatsPerSlice, err = tempo.ParseGrid(opts.Grid)
+		if err != nil {
+			return
+		}
+	}
+	b, err := opts.decode(ctx, fname)
+	if err != nil {
+		return
+	}
+
+	var beats tempo.Result
+	if opts.Grid != "" {
+		beats, err = tempo.DetectBuffer(b, opts.BPM)
+		if err != nil {
+			return
+		}
+		fmt.Printf("%s: %v bpm, first downbeat at %2.3f s\n", fname, beats.BPM, float64(beats.Downbeat)/tempo.SampleRate)
+	}
+	finalName, skip, err := opts.outputName(fname, "drum", 1, 1, beats.BPM)
+	if err != nil || skip {
+		if skip {
+			fmt.Printf("skipped %s, %s exists\n", fname, finalName)
+		}
+		return
+	}
+
 	op1data := op1.NewDrumPatch()
-	if slices == 0 {
-		segments, errSplit := ffmpeg.SplitOnSilence(fname2, -22, 0.2, -0.2)
+	op1data.SetDevice(device)
+	op1data.Normalization = opts.Normalization
+	// keys that are set from the audio, the others keep their defaults
+	var keys []int
+	slices := opts.Slices
+	if opts.Grid != "" {
+		// positions of the tempo detection are at its own sample rate
+		scale := float64(device.SampleRate) / tempo.SampleRate
+		starts, ends := beats.Slices(beatsPerSlice, tempo.SampleRate, int(float64(b.Frames())/scale), math.MaxInt32)
+		if len(starts) > device.Keys {
+			fmt.Printf("%s: only the first %d of %d slices of the grid fit on the keys\n", fname, device.Keys, len(starts))
+			starts, ends = starts[:device.Keys], ends[:device.Keys]
+		}
+		for i := range starts {
+			op1data.Start[i] = int64(float64(starts[i])*scale) * device.SampleConversion
+			op1data.End[i] = int64(float64(ends[i])*scale) * device.SampleConversion
+			keys = append(keys, i)
+		}
+	} else if slices == 0 {
+		segments, errSplit := onset.Segments(b, opts.Onset)
 		if errSplit != nil {
-			err = errSplit
-			return
+			log.Debugf("splitting on onsets: %s", errSplit)
+			segments, err = ffmpeg.SplitOnSilence(ctx, fname, -22, 0.2, -0.2)
+			if err != nil {
+				return
+			}
 		}
 		for i, seg := range segments {
 			if i < len(op1data.End)-2 {
-				start := int64(math.Floor(math.Round(seg.Start*100)*441)) * op1.SAMPLECONVERSION
-				end := int64(math.Floor(math.Round(seg.End*100)*441)) * op1.SAMPLECONVERSION
+				start := secondsToPosition(seg.Start, device)
+				end := secondsToPosition(seg.End, device)
 				if start > end {
 					continue
 				}
@@ -67,156 +231,152 @@ func ToDrumSplice(fname string, slices int) (err error) {
 				}
 				op1data.Start[i] = start
 				op1data.End[i] = end
+				keys = append(keys, i)
 			}
 		}
-	} else {
-		var totalSamples int64
-		totalSamples, _, err = ffmpeg.NumSamples(fname2)
-		if err != nil {
-			return
+		if len(segments) > len(op1data.End)-2 {
+			fmt.Printf("%s: only the first %d of %d onsets fit on the keys\n", fname, len(op1data.End)-2, len(segments))
 		}
+	} else {
+		totalSamples := int64(b.Frames())
 		log.Debugf("found %d samples", totalSamples)
 		for i := 0; i < slices; i++ {
-			op1data.Start[i] = int64(i) * totalSamples / int64(slices) * op1.SAMPLECONVERSION
-			op1data.End[i] = int64(i+1) * totalSamples / int64(slices) * op1.SAMPLECONVERSION
+			op1data.Start[i] = int64(i) * totalSamples / int64(slices) * device.SampleConversion
+			op1data.End[i] = int64(i+1) * totalSamples / int64(slices) * device.SampleConversion
+			keys = append(keys, i)
 		}
 	}
 
-	err = op1data.Save(fname2, finalName)
+	opts.snap(&op1data, b)
+	op1data.Declick(b, opts.Declick, keys)
+	op1data.Normalize(b, keys)
+
+	err = op1data.EditKeys(opts.Keys...)
+	if err != nil {
+		return
+	}
+
+	err = op1data.SaveBuffer(b, finalName)
 	if err == nil {
 		fmt.Printf("converted %+v -> %s\n", fname, finalName)
 	}
 	return
 }
 
-func ToDrum(fnames []string, slices int) (err error) {
+// ToDrum creates drum patches from one-shot files, starting a new patch
+// whenever the files do not fit into the keys or length of the device
+func ToDrum(ctx context.Context, fnames []string, opts Options) (err error) {
 	if len(fnames) == 0 {
 		err = fmt.Errorf("no files!")
 		return
 	}
 	if len(fnames) == 1 {
-		return ToDrumSplice(fnames[0], slices)
+		return ToDrumSplice(ctx, fnames[0], opts)
 	}
-	_, finalName := filepath.Split(fnames[0])
-	finalName = newName(finalName)
+	device := opts.device()
 	log.Debugf("converting %+v", fnames)
-	f, err := ioutil.TempFile(".", "concat")
-	defer os.Remove(f.Name())
-	sampleEnd := make([]int64, len(fnames))
-	fnames2 := make([]string, len(fnames))
+
+	// gaps between the files count towards the length of a patch. Only
+	// the lengths are kept, the files of each patch are decoded again so
+	// that no more than one patch is in memory.
+	gap := int64(opts.Declick.Gap * float64(device.SampleRate))
+	numSamples := make([]int64, len(fnames))
 	for i, fname := range fnames {
-		var fname2 string
-		fname2, err = ffmpeg.ToMono(fname)
-		defer os.Remove(fname2)
+		var b *audio.Buffer
+		b, err = opts.decode(ctx, fname)
 		if err != nil {
 			return
 		}
-		_, fnames2[i] = filepath.Split(fname2)
-		sampleEnd[i], _, err = ffmpeg.NumSamples(fname2)
+		numSamples[i] = int64(b.Frames())
+		log.Debugf("%s: %d samples", fname, numSamples[i])
+		numSamples[i] += gap
+	}
+
+	pages := paginate(numSamples, device.MaxDrumSamples(), device.Keys)
+	for page, indices := range pages {
+		var finalName string
+		var skip bool
+		finalName, skip, err = opts.outputName(fnames[0], "drum", page+1, len(pages), 0)
 		if err != nil {
 			return
 		}
-		if i > 0 {
-			sampleEnd[i] = sampleEnd[i] + sampleEnd[i-1]
-		}
-		if sampleEnd[i] > 44100*12 {
-			sampleEnd[i] = 44100 * 12
+		if skip {
+			fmt.Printf("skipped %s, it exists\n", finalName)
+			continue
 		}
-		sampleEnd[i] = sampleEnd[i]
-		log.Debugf("%s end: %d", fname, sampleEnd[i])
-	}
-	f.Close()
 
-	log.Debug(fnames)
-	fname2, err := ffmpeg.Concatenate(fnames2)
-	defer os.Remove(fname2)
-	if err != nil {
-		return
-	}
-
-	drumPatch := op1.NewDrumPatch()
-	for i, _ := range drumPatch.Start {
-		if i == len(sampleEnd) {
-			break
+		pageBuffers := make([]*audio.Buffer, len(indices))
+		sources := make([]string, len(indices))
+		for i, index := range indices {
+			pageBuffers[i], err = opts.decode(ctx, fnames[index])
+			if err != nil {
+				return
+			}
+			sources[i] = fnames[index]
 		}
-		if i == 0 {
-			drumPatch.Start[i] = 0
-		} else {
-			drumPatch.Start[i] = (sampleEnd[i-1]) * op1.SAMPLECONVERSION
+		err = toDrumPage(pageBuffers, finalName, opts)
+		if err != nil {
+			return
 		}
-		drumPatch.End[i] = (sampleEnd[i]) * op1.SAMPLECONVERSION
-	}
 
-	err = drumPatch.Save(fname2, finalName)
-	if err == nil {
-		fmt.Printf("converted %+v -> %s\n", fnames, finalName)
+		fmt.Printf("converted %d files -> %s\n", len(sources), finalName)
+		for i, source := range sources {
+			fmt.Printf("  key %2d: %s\n", i+1, source)
+		}
 	}
 	return
 }
 
-
-func ToDrum2(fnames []string, slices int) (finalName string, err error) {
-	if len(fnames) == 0 {
-		err = fmt.Errorf("no files!")
-		return
-	}
-	if len(fnames) == 1 {
-		err = ToDrumSplice(fnames[0], slices)
-		return
-	}
-	_, finalName = filepath.Split(fnames[0])
-	finalName = newName(finalName)
-	log.Debugf("converting %+v", fnames)
-	f, err := ioutil.TempFile(".", "concat")
-	defer os.Remove(f.Name())
-	sampleEnd := make([]int64, len(fnames))
-	fnames2 := make([]string, len(fnames))
-	for i, fname := range fnames {
-		var fname2 string
-		fname2, err = ffmpeg.ToMono(fname)
-		defer os.Remove(fname2)
-		if err != nil {
-			return
+// paginate splits files into groups that each fit into a drum patch,
+// keeping their order. A file that is too long gets its own patch.
+func paginate(numSamples []int64, maxSamples int64, maxKeys int) (pages [][]int) {
+	var page []int
+	var total int64
+	for i, n := range numSamples {
+		if len(page) > 0 && (len(page) == maxKeys || total+n > maxSamples) {
+			pages = append(pages, page)
+			page = []int{}
+			total = 0
 		}
-		_, fnames2[i] = filepath.Split(fname2)
-		sampleEnd[i], _, err = ffmpeg.NumSamples(fname2)
-		if err != nil {
-			return
-		}
-		if i > 0 {
-			sampleEnd[i] = sampleEnd[i] + sampleEnd[i-1]
-		}
-		if sampleEnd[i] > 44100*12 {
-			sampleEnd[i] = 44100 * 12
-		}
-		sampleEnd[i] = sampleEnd[i]
-		log.Debugf("%s end: %d", fname, sampleEnd[i])
+		page = append(page, i)
+		total += n
+	}
+	if len(page) > 0 {
+		pages = append(pages, page)
 	}
-	f.Close()
+	return
+}
 
-	log.Debug(fnames)
-	fname2, err := ffmpeg.Concatenate(fnames2)
-	defer os.Remove(fname2)
+// toDrumPage joins resampled audio into a single drum patch, with one
+// buffer per key
+func toDrumPage(buffers []*audio.Buffer, finalName string, opts Options) (err error) {
+	device := opts.device()
+	b, starts, ends, err := opts.Declick.Join(buffers...)
 	if err != nil {
 		return
 	}
 
 	drumPatch := op1.NewDrumPatch()
-	for i, _ := range drumPatch.Start {
-		if i == len(sampleEnd) {
+	drumPatch.SetDevice(device)
+	drumPatch.Normalization = opts.Normalization
+	var keys []int
+	for i := range drumPatch.Start {
+		if i == len(starts) {
 			break
 		}
-		if i == 0 {
-			drumPatch.Start[i] = 0
-		} else {
-			drumPatch.Start[i] = (sampleEnd[i-1]) * op1.SAMPLECONVERSION
-		}
-		drumPatch.End[i] = (sampleEnd[i]) * op1.SAMPLECONVERSION
+		keys = append(keys, i)
+		drumPatch.Start[i] = int64(starts[i]) * device.SampleConversion
+		drumPatch.End[i] = int64(ends[i]) * device.SampleConversion
 	}
 
-	err = drumPatch.Save(fname2, finalName)
-	if err == nil {
-		fmt.Printf("converted %+v -> %s\n", fnames, finalName)
+	opts.snap(&drumPatch, b)
+	drumPatch.Normalize(b, keys)
+
+	err = drumPatch.EditKeys(opts.Keys...)
+	if err != nil {
+		return
 	}
+
+	err = drumPatch.SaveBuffer(b, finalName)
 	return
-}
\ No newline at end of file
+}
@@ -0,0 +1,164 @@
+package convert
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schollz/teoperator/src/audio"
+	"github.com/schollz/teoperator/src/op1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaginate(t *testing.T) {
+	// 60 one-shots make three full kits
+	numSamples := make([]int64, 60)
+	for i := range numSamples {
+		numSamples[i] = 1000
+	}
+	pages := paginate(numSamples, 44100*12, 24)
+	assert.Equal(t, 3, len(pages))
+	assert.Equal(t, 24, len(pages[0]))
+	assert.Equal(t, 24, len(pages[1]))
+	assert.Equal(t, 12, len(pages[2]))
+	assert.Equal(t, 24, pages[1][0])
+
+	// long files fill up the length
+	pages = paginate([]int64{5, 5, 5, 12, 1}, 12, 24)
+	assert.Equal(t, [][]int{{0, 1}, {2}, {3}, {4}}, pages)
+
+	assert.Empty(t, paginate(nil, 12, 24))
+}
+
+func TestTooLong(t *testing.T) {
+	dir := t.TempDir()
+	long := filepath.Join(dir, "long.wav")
+	b := &audio.Buffer{SampleRate: 44100, Channels: 1, Samples: make([]float64, 13*44100)}
+	assert.Nil(t, b.WriteWAV(long))
+	short := filepath.Join(dir, "short.wav")
+	b.Samples = b.Samples[:44100]
+	assert.Nil(t, b.WriteWAV(short))
+
+	// files are not cut to fit
+	_, err := Options{}.decode(context.Background(), long)
+	assert.Contains(t, err.Error(), "long.wav is longer than the 12.000 seconds of a drum patch for the op-1")
+	b, err = Options{}.decode(context.Background(), short)
+	assert.Nil(t, err)
+	assert.Equal(t, 44100, b.Frames())
+	assert.NotNil(t, ToDrum(context.Background(), []string{short, long}, Options{OutDir: dir}))
+
+	// slices do not leave audio off the keys
+	err = ToDrumSplice(context.Background(), short, Options{Slices: 30, OutDir: dir})
+	assert.Equal(t, "30 slices do not fit on the 24 keys of the op-1", err.Error())
+}
+
+func TestFindFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "findfiles")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, fname := range []string{"kick10.wav", "kick2.wav", "notes.txt", "hats/hat1.aif", "hats/old/hat2.mp3"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(fname)), os.ModePerm)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, fname), []byte{}, 0644))
+	}
+	// patches of an earlier run are not converted again
+	dp := op1.NewDrumPatch()
+	assert.Nil(t, dp.SaveBuffer(&audio.Buffer{SampleRate: 44100, Channels: 1, Samples: make([]float64, 4410)}, filepath.Join(dir, "kick2_patch.aif")))
+
+	fnames, err := FindFiles(context.Background(), []string{dir}, FileOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "hats/hat1.aif"),
+		filepath.Join(dir, "hats/old/hat2.mp3"),
+		filepath.Join(dir, "kick2.wav"),
+		filepath.Join(dir, "kick10.wav"),
+	}, fnames)
+
+	fnames, err = FindFiles(context.Background(), []string{dir}, FileOptions{Include: []string{"kick*"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "kick2.wav"), filepath.Join(dir, "kick10.wav")}, fnames)
+
+	fnames, err = FindFiles(context.Background(), []string{dir}, FileOptions{Exclude: []string{"*.mp3", "kick1*"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "hats/hat1.aif"), filepath.Join(dir, "kick2.wav")}, fnames)
+
+	// explicit files keep their order unless sorted
+	args := []string{filepath.Join(dir, "kick10.wav"), filepath.Join(dir, "notes.txt"), filepath.Join(dir, "k*2.wav")}
+	fnames, err = FindFiles(context.Background(), args, FileOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{args[0], args[1], filepath.Join(dir, "kick2.wav")}, fnames)
+	fnames, err = FindFiles(context.Background(), args, FileOptions{SortBy: "name"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "kick2.wav"), args[0], args[1]}, fnames)
+
+	_, err = FindFiles(context.Background(), []string{filepath.Join(dir, "nothing*")}, FileOptions{})
+	assert.NotNil(t, err)
+	_, err = FindFiles(context.Background(), []string{dir}, FileOptions{SortBy: "color"})
+	assert.NotNil(t, err)
+}
+
+func TestOutputName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputname")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "in", "kick.wav")
+
+	fname, skip, err := Options{}.outputName(input, "drum", 1, 1, 0)
+	assert.Nil(t, err)
+	assert.False(t, skip)
+	assert.Equal(t, filepath.Join(dir, "in", "kick_patch.aif"), fname)
+
+	// split kits are numbered
+	fname, _, err = Options{}.outputName(input, "drum", 2, 3, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "in", "kick_patch_2.aif"), fname)
+
+	opts := Options{OutDir: filepath.Join(dir, "out"), Template: "{name}_{device}_{type}_{n}"}
+	fname, _, err = opts.outputName(input, "synth", 1, 1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "out", "kick_op-1_synth_1.aif"), fname)
+	assert.Nil(t, ioutil.WriteFile(fname, []byte{}, 0644))
+
+	// collisions
+	fname, skip, err = opts.outputName(input, "synth", 1, 1, 0)
+	assert.Nil(t, err)
+	assert.False(t, skip)
+	assert.Equal(t, filepath.Join(dir, "out", "kick_op-1_synth_1_2.aif"), fname)
+	opts.Collision = CollisionSkip
+	_, skip, err = opts.outputName(input, "synth", 1, 1, 0)
+	assert.Nil(t, err)
+	assert.True(t, skip)
+	opts.Collision = CollisionOverwrite
+	fname, skip, err = opts.outputName(input, "synth", 1, 1, 0)
+	assert.Nil(t, err)
+	assert.False(t, skip)
+	assert.Equal(t, filepath.Join(dir, "out", "kick_op-1_synth_1.aif"), fname)
+	fname, _, err = Options{}.outputName(input, "drum", 1, 1, 120.5)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "in", "kick_patch_120.5bpm.aif"), fname)
+	fname, _, err = Options{Template: "{bpm}-{name}"}.outputName(input, "drum", 1, 1, 90)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "in", "90-kick.aif"), fname)
+
+	opts.Collision = "rename"
+	_, _, err = opts.outputName(input, "synth", 1, 1, 0)
+	assert.NotNil(t, err)
+}
+
+func TestDetectBufferBaseFreq(t *testing.T) {
+	b := &audio.Buffer{SampleRate: 44100, Channels: 1, Samples: make([]float64, 44100)}
+	for i := range b.Samples {
+		b.Samples[i] = 0.5 * math.Sin(2*math.Pi*220*float64(i)/44100)
+	}
+	baseFreq, note, err := DetectBufferBaseFreq(b)
+	assert.Nil(t, err)
+	assert.InDelta(t, 220, baseFreq, 1)
+	assert.Contains(t, note, "A3")
+
+	// silence falls back
+	baseFreq, _, err = DetectBufferBaseFreq(&audio.Buffer{SampleRate: 44100, Channels: 1, Samples: make([]float64, 44100)})
+	assert.NotNil(t, err)
+	assert.Equal(t, float64(FallbackFreq), baseFreq)
+}
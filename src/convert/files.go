@@ -0,0 +1,160 @@
+package convert
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/schollz/logger"
+	"github.com/schollz/teoperator/src/ffmpeg"
+	"github.com/schollz/teoperator/src/op1"
+	"github.com/schollz/teoperator/src/utils"
+)
+
+// AudioExtensions are the files picked up when searching directories
+var AudioExtensions = []string{".aif", ".aiff", ".flac", ".m4a", ".mp3", ".ogg", ".opus", ".wav"}
+
+// FileOptions select and order the files found by FindFiles
+type FileOptions struct {
+	// Include and Exclude are globs matched against the file name,
+	// or against the whole path if the glob contains a slash
+	Include []string
+	Exclude []string
+	// SortBy is "name" for natural sort, "duration" for shortest first,
+	// or empty to keep the order of the arguments
+	SortBy string
+}
+
+// FindFiles expands the arguments into files. Arguments can be files,
+// directories (searched recursively for audio files) or globs.
+func FindFiles(ctx context.Context, args []string, fo FileOptions) (fnames []string, err error) {
+	for _, arg := range args {
+		var matches []string
+		if _, errStat := os.Stat(arg); errStat == nil {
+			matches = []string{arg}
+		} else {
+			matches, err = filepath.Glob(arg)
+			if err != nil {
+				return
+			}
+			if len(matches) == 0 {
+				err = fmt.Errorf("could not find '%s'", arg)
+				return
+			}
+			sort.Slice(matches, func(i, j int) bool {
+				return utils.NaturalLess(matches[i], matches[j])
+			})
+		}
+
+		for _, match := range matches {
+			var info os.FileInfo
+			info, err = os.Stat(match)
+			if err != nil {
+				return
+			}
+			if !info.IsDir() {
+				if fo.keep(match, false) {
+					fnames = append(fnames, match)
+				}
+				continue
+			}
+
+			var found []string
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.IsDir() && fo.keep(path, true) {
+					found = append(found, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return
+			}
+			sort.Slice(found, func(i, j int) bool {
+				return utils.NaturalLess(found[i], found[j])
+			})
+			fnames = append(fnames, found...)
+		}
+	}
+
+	switch fo.SortBy {
+	case "":
+	case "name":
+		sort.SliceStable(fnames, func(i, j int) bool {
+			return utils.NaturalLess(fnames[i], fnames[j])
+		})
+	case "duration":
+		durations := make(map[string]float64)
+		for _, fname := range fnames {
+			var m ffmpeg.Media
+			m, err = ffmpeg.Probe(ctx, fname)
+			durations[fname] = m.Duration
+			if err != nil {
+				err = fmt.Errorf("could not get duration of '%s': %s", fname, err.Error())
+				return
+			}
+		}
+		sort.SliceStable(fnames, func(i, j int) bool {
+			return durations[fnames[i]] < durations[fnames[j]]
+		})
+	default:
+		err = fmt.Errorf("unknown sort '%s', use 'name' or 'duration'", fo.SortBy)
+		return
+	}
+	log.Debugf("found files: %+v", fnames)
+	return
+}
+
+// keep returns whether a file passes the include and exclude globs. Files
+// found in directories also need an audio extension if nothing is included,
+// and patches in directories are skipped so that the output of an earlier
+// run is not converted again.
+func (fo FileOptions) keep(fname string, inDirectory bool) bool {
+	for _, pattern := range fo.Exclude {
+		if matchGlob(pattern, fname) {
+			return false
+		}
+	}
+	if !inDirectory {
+		return len(fo.Include) == 0 || fo.included(fname)
+	}
+	if len(fo.Include) == 0 && !hasAudioExtension(fname) {
+		return false
+	}
+	if len(fo.Include) > 0 && !fo.included(fname) {
+		return false
+	}
+	return !op1.IsPatch(fname)
+}
+
+func (fo FileOptions) included(fname string) bool {
+	for _, pattern := range fo.Include {
+		if matchGlob(pattern, fname) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAudioExtension(fname string) bool {
+	ext := strings.ToLower(filepath.Ext(fname))
+	for _, audioExt := range AudioExtensions {
+		if ext == audioExt {
+			return true
+		}
+	}
+	return false
+}
+
+func matchGlob(pattern, fname string) bool {
+	if !strings.Contains(pattern, "/") {
+		fname = filepath.Base(fname)
+	}
+	matched, _ := filepath.Match(pattern, filepath.ToSlash(fname))
+	return matched
+}
@@ -0,0 +1,86 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultTemplate names patches after their input
+const DefaultTemplate = "{name}_patch.aif"
+
+// collision policies for when a patch already exists
+const (
+	CollisionIncrement = "increment"
+	CollisionOverwrite = "overwrite"
+	CollisionSkip      = "skip"
+)
+
+// outputName returns the name of a patch made from the input. The template can
+// use {name} (the input without extension), {device}, {type}, {n} (the patch
+// number when a kit needs several patches) and {bpm} (the tempo of loops
+// sliced on a grid, added to the name if bpm is not 0). Skip is true if the
+// patch exists and should not be overwritten.
+func (opts Options) outputName(input string, patchType string, n int, patches int, bpm float64) (fname string, skip bool, err error) {
+	switch opts.Collision {
+	case "", CollisionIncrement, CollisionOverwrite, CollisionSkip:
+	default:
+		err = fmt.Errorf("unknown collision policy '%s', use increment, overwrite or skip", opts.Collision)
+		return
+	}
+
+	template := opts.Template
+	if template == "" {
+		template = DefaultTemplate
+	}
+	if patches > 1 && !strings.Contains(template, "{n}") {
+		template = strings.TrimSuffix(template, ".aif") + "_{n}.aif"
+	}
+	if bpm > 0 && !strings.Contains(template, "{bpm}") {
+		template = strings.TrimSuffix(template, ".aif") + "_{bpm}bpm.aif"
+	}
+	if !strings.HasSuffix(template, ".aif") {
+		template += ".aif"
+	}
+
+	folder, name := filepath.Split(input)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if opts.OutDir != "" {
+		folder = opts.OutDir
+		err = os.MkdirAll(folder, os.ModePerm)
+		if err != nil {
+			return
+		}
+	}
+	fname = filepath.Join(folder, strings.NewReplacer(
+		"{name}", name,
+		"{device}", opts.device().Name,
+		"{type}", patchType,
+		"{n}", fmt.Sprint(n),
+		"{bpm}", strconv.FormatFloat(bpm, 'f', -1, 64),
+	).Replace(template))
+
+	if _, errStat := os.Stat(fname); os.IsNotExist(errStat) {
+		return
+	}
+	switch opts.Collision {
+	case CollisionOverwrite:
+	case CollisionSkip:
+		skip = true
+	default:
+		base := strings.TrimSuffix(fname, ".aif")
+		if last := base[len(base)-1]; last >= '0' && last <= '9' {
+			// kick_1.aif becomes kick_1_2.aif rather than kick_12.aif
+			base += "_"
+		}
+		for i := 2; ; i++ {
+			fname = fmt.Sprintf("%s%d.aif", base, i)
+			if _, errStat := os.Stat(fname); os.IsNotExist(errStat) {
+				break
+			}
+		}
+	}
+	return
+}
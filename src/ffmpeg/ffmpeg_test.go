@@ -1,11 +1,87 @@
 package ffmpeg
 
 import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
+	"github.com/schollz/teoperator/src/aiff"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestNormalize(t *testing.T) {
-	assert.Nil(t, Normalize("normalize.aif", "normalized.aif"))
+func TestParseProbe(t *testing.T) {
+	out := []byte(`{
+    "streams": [
+        {"codec_type": "video", "codec_name": "png"},
+        {
+            "codec_name": "pcm_s24le", "codec_type": "audio", "sample_rate": "48000",
+            "channels": 2, "bits_per_sample": 24, "time_base": "1/48000",
+            "start_time": "0.000000", "duration_ts": 96001, "duration": "2.000021",
+            "tags": {"encoder": "test"}
+        }
+    ],
+    "chapters": [
+        {"start_time": "0.500000", "end_time": "1.000000", "tags": {"title": "verse"}}
+    ],
+    "format": {"start_time": "0.000000", "duration": "2.000021", "tags": {"TITLE": "loop"}}
+}`)
+	m, err := parseProbe(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "pcm_s24le", m.Codec)
+	assert.Equal(t, 48000, m.SampleRate)
+	assert.Equal(t, 2, m.Channels)
+	assert.Equal(t, 24, m.BitDepth)
+	assert.Equal(t, int64(96001), m.Frames)
+	assert.Equal(t, 2.000021, m.Duration)
+	assert.Equal(t, map[string]string{"title": "loop", "encoder": "test"}, m.Tags)
+	assert.Equal(t, []CuePoint{{Name: "verse", Start: 0.5, End: 1}}, m.CuePoints)
+
+	// lossy streams count samples from the duration
+	m, err = parseProbe([]byte(`{"streams": [{"codec_name": "mp3", "codec_type": "audio",
+		"sample_rate": "44100", "channels": 1, "time_base": "1/14112000", "duration": "1.5"}], "format": {}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, m.BitDepth)
+	assert.Equal(t, int64(66150), m.Frames)
+
+	_, err = parseProbe([]byte(`{"streams": [{"codec_type": "video"}], "format": {}}`))
+	assert.NotNil(t, err)
+}
+
+func TestCuePoints(t *testing.T) {
+	dir := t.TempDir()
+
+	// a wav with two cue points, one of them labeled
+	var b []byte
+	chunk := func(id string, data []byte) {
+		b = append(b, id...)
+		b = append(b, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(b[len(b)-4:], uint32(len(data)))
+		b = append(b, data...)
+	}
+	le := func(values ...uint32) (data []byte) {
+		for _, v := range values {
+			data = append(data, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint32(data[len(data)-4:], v)
+		}
+		return
+	}
+	chunk("fmt ", make([]byte, 16))
+	chunk("data", make([]byte, 8))
+	chunk("cue ", le(2, 1, 0, 0x61746164, 0, 0, 22050, 2, 0, 0x61746164, 0, 0, 44100))
+	chunk("LIST", append([]byte("adtllabl"), append(le(10, 2), "kick\x00\x00"...)...))
+	wavName := filepath.Join(dir, "cues.wav")
+	assert.Nil(t, ioutil.WriteFile(wavName, append(append([]byte("RIFF"), le(uint32(len(b)+4))...), append([]byte("WAVE"), b...)...), 0644))
+	cues, err := wavCuePoints(wavName, 44100)
+	assert.Nil(t, err)
+	assert.Equal(t, []CuePoint{{Start: 0.5}, {Name: "kick", Start: 1}}, cues)
+
+	var f aiff.File
+	f.Type = "AIFF"
+	f.SetMarkers([]aiff.Marker{{ID: 1, Position: 11025, Name: "snare"}})
+	aiffName := filepath.Join(dir, "cues.aif")
+	assert.Nil(t, f.WriteFile(aiffName))
+	cues, err = aiffCuePoints(aiffName, 44100)
+	assert.Nil(t, err)
+	assert.Equal(t, []CuePoint{{Name: "snare", Start: 0.25}}, cues)
 }
@@ -0,0 +1,235 @@
+package ffmpeg
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/schollz/teoperator/src/aiff"
+	"github.com/schollz/teoperator/src/command"
+)
+
+// Media describes the first audio stream of a file
+type Media struct {
+	// Duration and Start are in seconds
+	Duration   float64
+	Start      float64
+	SampleRate int
+	Channels   int
+	// Frames is the number of samples per channel
+	Frames int64
+	Codec  string
+	// BitDepth is 0 for lossy codecs
+	BitDepth int
+	// Tags of the file and the stream, with lowercase keys
+	Tags      map[string]string
+	CuePoints []CuePoint
+}
+
+// CuePoint is a marker or chapter, in seconds. End is 0 for markers.
+type CuePoint struct {
+	Name  string
+	Start float64
+	End   float64
+}
+
+// Probe describes an audio file using ffprobe. Cue points are read from
+// chapters, wav cue chunks and aiff markers.
+func Probe(ctx context.Context, fname string) (m Media, err error) {
+	out, _, err := command.Run(ctx, ProbeTimeout, "ffprobe", "-v", "error", "-print_format", "json",
+		"-show_format", "-show_streams", "-show_chapters", fname)
+	if err != nil {
+		return
+	}
+	m, err = parseProbe(out)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", fname, err.Error())
+		return
+	}
+
+	var markers []CuePoint
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".wav":
+		markers, err = wavCuePoints(fname, m.SampleRate)
+	case ".aif", ".aiff", ".aifc":
+		markers, err = aiffCuePoints(fname, m.SampleRate)
+	}
+	if err != nil {
+		return
+	}
+	m.CuePoints = append(m.CuePoints, markers...)
+	sort.SliceStable(m.CuePoints, func(i, j int) bool {
+		return m.CuePoints[i].Start < m.CuePoints[j].Start
+	})
+	return
+}
+
+type probeOutput struct {
+	Streams []struct {
+		CodecType        string            `json:"codec_type"`
+		CodecName        string            `json:"codec_name"`
+		SampleRate       string            `json:"sample_rate"`
+		Channels         int               `json:"channels"`
+		BitsPerSample    int               `json:"bits_per_sample"`
+		BitsPerRawSample string            `json:"bits_per_raw_sample"`
+		TimeBase         string            `json:"time_base"`
+		StartTime        string            `json:"start_time"`
+		Duration         string            `json:"duration"`
+		DurationTS       int64             `json:"duration_ts"`
+		Tags             map[string]string `json:"tags"`
+	} `json:"streams"`
+	Chapters []struct {
+		StartTime string            `json:"start_time"`
+		EndTime   string            `json:"end_time"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"chapters"`
+	Format struct {
+		StartTime string            `json:"start_time"`
+		Duration  string            `json:"duration"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// parseProbe reads the json of ffprobe
+func parseProbe(out []byte) (m Media, err error) {
+	var p probeOutput
+	err = json.Unmarshal(out, &p)
+	if err != nil {
+		return
+	}
+	found := false
+	for _, s := range p.Streams {
+		if s.CodecType != "audio" {
+			continue
+		}
+		found = true
+		m.Codec = s.CodecName
+		m.SampleRate, _ = strconv.Atoi(s.SampleRate)
+		m.Channels = s.Channels
+		m.BitDepth, _ = strconv.Atoi(s.BitsPerRawSample)
+		if m.BitDepth == 0 {
+			m.BitDepth = s.BitsPerSample
+		}
+		m.Start = parseSeconds(s.StartTime)
+		m.Duration = parseSeconds(s.Duration)
+		// the duration in samples is exact if the time base is the sample rate
+		if s.TimeBase == fmt.Sprintf("1/%d", m.SampleRate) && s.DurationTS > 0 {
+			m.Frames = s.DurationTS
+		}
+		m.Tags = lowerKeys(p.Format.Tags, s.Tags)
+		break
+	}
+	if !found {
+		err = fmt.Errorf("no audio stream")
+		return
+	}
+	if m.Duration == 0 {
+		m.Duration = parseSeconds(p.Format.Duration)
+		m.Start = parseSeconds(p.Format.StartTime)
+	}
+	if m.Frames == 0 {
+		m.Frames = int64(math.Round(m.Duration * float64(m.SampleRate)))
+	}
+	for _, c := range p.Chapters {
+		m.CuePoints = append(m.CuePoints, CuePoint{
+			Name:  c.Tags["title"],
+			Start: parseSeconds(c.StartTime),
+			End:   parseSeconds(c.EndTime),
+		})
+	}
+	return
+}
+
+func parseSeconds(s string) float64 {
+	seconds, _ := strconv.ParseFloat(s, 64)
+	return seconds
+}
+
+func lowerKeys(tags ...map[string]string) (lower map[string]string) {
+	lower = make(map[string]string)
+	for _, t := range tags {
+		for k, v := range t {
+			lower[strings.ToLower(k)] = v
+		}
+	}
+	return
+}
+
+// wavCuePoints reads the cue chunk of a wav file, with names from the
+// labels of its list chunk
+func wavCuePoints(fname string, sampleRate int) (cues []CuePoint, err error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil || len(b) < 12 || string(b[0:4]) != "RIFF" || sampleRate == 0 {
+		return
+	}
+	offsets := make(map[uint32]uint32)
+	var ids []uint32
+	labels := make(map[uint32]string)
+	for i := 12; i+8 <= len(b); {
+		id := string(b[i : i+4])
+		size := int(binary.LittleEndian.Uint32(b[i+4 : i+8]))
+		i += 8
+		if size < 0 || i+size > len(b) {
+			break
+		}
+		chunk := b[i : i+size]
+		switch id {
+		case "cue ":
+			for j := 4; j+24 <= len(chunk); j += 24 {
+				cueID := binary.LittleEndian.Uint32(chunk[j:])
+				ids = append(ids, cueID)
+				offsets[cueID] = binary.LittleEndian.Uint32(chunk[j+20:])
+			}
+		case "LIST":
+			if len(chunk) < 4 || string(chunk[0:4]) != "adtl" {
+				break
+			}
+			for j := 4; j+8 <= len(chunk); {
+				subID := string(chunk[j : j+4])
+				subSize := int(binary.LittleEndian.Uint32(chunk[j+4:]))
+				j += 8
+				if subSize < 4 || j+subSize > len(chunk) {
+					break
+				}
+				if subID == "labl" {
+					labels[binary.LittleEndian.Uint32(chunk[j:])] = strings.TrimRight(string(chunk[j+4:j+subSize]), "\x00")
+				}
+				j += subSize + subSize%2
+			}
+		}
+		i += size + size%2
+	}
+	for _, id := range ids {
+		cues = append(cues, CuePoint{
+			Name:  labels[id],
+			Start: float64(offsets[id]) / float64(sampleRate),
+		})
+	}
+	return
+}
+
+// aiffCuePoints reads the markers of an aiff file
+func aiffCuePoints(fname string, sampleRate int) (cues []CuePoint, err error) {
+	f, err := aiff.ReadFile(fname)
+	if err != nil || sampleRate == 0 {
+		return
+	}
+	markers, err := f.Markers()
+	if err != nil {
+		return
+	}
+	for _, marker := range markers {
+		cues = append(cues, CuePoint{
+			Name:  marker.Name,
+			Start: float64(marker.Position) / float64(sampleRate),
+		})
+	}
+	return
+}
@@ -0,0 +1,114 @@
+package inspect
+
+import (
+	"bytes"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/schollz/teoperator/src/audio"
+	"github.com/schollz/teoperator/src/op1"
+	"github.com/schollz/teoperator/src/waveform"
+)
+
+// Patch describes a patch file
+type Patch struct {
+	Filename string `json:"filename"`
+	Type     string `json:"type"`
+	// Duration is the length of the audio in seconds
+	Duration   float64 `json:"duration"`
+	SampleRate int     `json:"sample_rate"`
+	Channels   int     `json:"channels"`
+	// Metadata is the op1.DrumPatch or op1.SynthPatch of the file
+	Metadata interface{} `json:"metadata"`
+	// Keys are the keys of a drum patch
+	Keys []op1.Key `json:"keys,omitempty"`
+
+	audio *audio.Buffer
+}
+
+// Read reads the metadata and audio of a patch
+func Read(fname string) (p Patch, err error) {
+	p.Filename = fname
+	p.Metadata, err = op1.ReadPatch(fname)
+	if err != nil {
+		return
+	}
+	switch patch := p.Metadata.(type) {
+	case op1.DrumPatch:
+		p.Type = patch.Type
+		p.Keys, err = patch.Keys()
+	case op1.SynthPatch:
+		p.Type = patch.Type
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %s", fname, err.Error())
+		return
+	}
+	p.audio, err = audio.Decode(fname)
+	if err != nil {
+		return
+	}
+	p.Duration = p.audio.Duration()
+	p.SampleRate = p.audio.SampleRate
+	p.Channels = p.audio.Channels
+	return
+}
+
+// Table returns the patch as a table to read
+func (p Patch) Table() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "file\t%s\n", p.Filename)
+	fmt.Fprintf(w, "audio\t%2.3f s, %d hz, %d channel(s)\n", p.Duration, p.SampleRate, p.Channels)
+	switch patch := p.Metadata.(type) {
+	case op1.DrumPatch:
+		fmt.Fprintf(w, "type\tdrum (version %d, %s)\n", patch.DrumVersion, op1.DrumDeviceNames(patch.DrumVersion))
+		fmt.Fprintf(w, "name\t%s\n", patch.Name)
+		fmt.Fprintf(w, "fx\t%s\n", onOff(patch.FxType, patch.FxActive))
+		fmt.Fprintf(w, "lfo\t%s\n", onOff(patch.LfoType, patch.LfoActive))
+		w.Flush()
+		w = tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(&buf)
+		fmt.Fprintf(w, "key\tstart\tend\tpitch\tvolume\treverse\tplaymode\t\n")
+		for i, k := range p.Keys {
+			reverse := "no"
+			if k.Reverse {
+				reverse = "yes"
+			}
+			fmt.Fprintf(w, "%d\t%2.3f\t%2.3f\t%+g\t%2.0f%%\t%s\t%s\t\n", i+1, k.Start, k.End, k.Pitch, k.Volume, reverse, k.Playmode)
+		}
+	case op1.SynthPatch:
+		fmt.Fprintf(w, "type\t%s (version %d)\n", patch.Type, patch.SynthVersion)
+		fmt.Fprintf(w, "name\t%s\n", patch.Name)
+		if patch.BaseFreq > 0 {
+			fmt.Fprintf(w, "base freq\t%g hz\n", patch.BaseFreq)
+		}
+		fmt.Fprintf(w, "octave\t%d\n", patch.Octave)
+		fmt.Fprintf(w, "knobs\t%v\n", patch.Knobs)
+		fmt.Fprintf(w, "adsr\t%v\n", patch.Adsr)
+		fmt.Fprintf(w, "fx\t%s %v\n", onOff(patch.FxType, patch.FxActive), patch.FxParams)
+		fmt.Fprintf(w, "lfo\t%s %v\n", onOff(patch.LfoType, patch.LfoActive), patch.LfoParams)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// Waveform draws the audio as text, with the start of each key marked
+// below it
+func (p Patch) Waveform(width, height int) string {
+	if p.audio == nil {
+		return ""
+	}
+	var markers []float64
+	for _, k := range p.Keys {
+		markers = append(markers, k.Start)
+	}
+	return waveform.ASCII(p.audio, width, height, markers)
+}
+
+func onOff(name string, active bool) string {
+	if active {
+		return name + " (on)"
+	}
+	return name + " (off)"
+}
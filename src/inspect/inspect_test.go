@@ -0,0 +1,39 @@
+package inspect
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/schollz/teoperator/src/op1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrum(t *testing.T) {
+	p, err := Read("../op1/tests/1.aif")
+	assert.Nil(t, err)
+	assert.Equal(t, "drum", p.Type)
+	assert.Equal(t, 44100, p.SampleRate)
+	assert.InDelta(t, 11.358, p.Duration, 0.001)
+	assert.Len(t, p.Keys, op1.NUMKEYS)
+	assert.Equal(t, "boombap1", p.Metadata.(op1.DrumPatch).Name)
+
+	table := p.Table()
+	assert.Contains(t, table, "type   drum (version 2, op-1/op-z)\n")
+	assert.Contains(t, table, "    2  0.546   0.923     +0    100%       no   oneshot\n")
+
+	lines := strings.Split(strings.TrimSuffix(p.Waveform(40, 4), "\n"), "\n")
+	assert.Len(t, lines, 5)
+	assert.Len(t, lines[0], 40)
+	assert.True(t, strings.HasPrefix(lines[4], "||"))
+}
+
+func TestSynth(t *testing.T) {
+	p, err := Read("../op1/reverse/engines/cluster0.aif")
+	assert.Nil(t, err)
+	assert.Equal(t, "cluster", p.Type)
+	assert.Empty(t, p.Keys)
+	assert.Contains(t, p.Table(), "fx      nitro (on) [64 -14337 4515 7232 0 0 0 0]\n")
+
+	_, err = Read("inspect.go")
+	assert.NotNil(t, err)
+}
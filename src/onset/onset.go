@@ -0,0 +1,317 @@
+package onset
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+
+	log "github.com/schollz/logger"
+	"github.com/schollz/teoperator/src/audio"
+	"github.com/schollz/teoperator/src/models"
+)
+
+// onset detection functions
+const (
+	// SpectralFlux sums the increase of each frequency bin, good for most material
+	SpectralFlux = "specflux"
+	// HFC weights energy by frequency, good for percussive material
+	HFC = "hfc"
+	// Complex compares bins with a prediction from their phase, good for
+	// soft onsets and pitch changes
+	Complex = "complex"
+)
+
+// Methods are all onset detection functions
+var Methods = []string{SpectralFlux, HFC, Complex}
+
+// Hop is the number of samples between values of the onset strength
+const Hop = 256
+
+const (
+	sampleRate = 44100
+	frameSize  = 1024
+	hop        = Hop
+	// frames in the median filter before and after a frame
+	medianBefore = 8
+	medianAfter  = 3
+)
+
+// Options tune the onset detection
+type Options struct {
+	// Method is SpectralFlux, HFC or Complex
+	Method string
+	// Threshold is how much a peak must rise above its surroundings,
+	// from 0 to 1 (higher finds fewer onsets)
+	Threshold float64
+	// MinInterval is the minimum seconds between onsets
+	MinInterval float64
+	// Silence is the level in dB below which there are no onsets
+	Silence float64
+	// Backtrack moves onsets to the start of the attack and then back to
+	// the previous zero crossing
+	Backtrack bool
+}
+
+// DefaultOptions are used for empty options, and their values for empty
+// fields of other options
+var DefaultOptions = Options{
+	Method:      SpectralFlux,
+	Threshold:   0.1,
+	MinInterval: 0.1,
+	Silence:     -40,
+	Backtrack:   true,
+}
+
+func (o Options) orDefault() Options {
+	if o == (Options{}) {
+		return DefaultOptions
+	}
+	if o.Method == "" {
+		o.Method = DefaultOptions.Method
+	}
+	if o.Threshold == 0 {
+		o.Threshold = DefaultOptions.Threshold
+	}
+	if o.MinInterval == 0 {
+		o.MinInterval = DefaultOptions.MinInterval
+	}
+	if o.Silence == 0 {
+		o.Silence = DefaultOptions.Silence
+	}
+	return o
+}
+
+// Split splits any audio file into segments that each start at an onset
+func Split(fname string, opts Options) (segments []models.AudioSegment, err error) {
+	b, err := audio.Decode(fname)
+	if err != nil {
+		return
+	}
+	segments, err = Segments(b, opts)
+	for i := range segments {
+		segments[i].Filename = fname
+	}
+	return
+}
+
+// Segments splits decoded audio into segments that each start at an onset
+func Segments(b *audio.Buffer, opts Options) (segments []models.AudioSegment, err error) {
+	samples := b.Convert(sampleRate, 1, 0).Samples
+	onsets, err := Detect(samples, sampleRate, opts)
+	if err != nil {
+		return
+	}
+	if len(onsets) == 0 {
+		err = fmt.Errorf("could not find any segments")
+		return
+	}
+	for i, start := range onsets {
+		end := len(samples)
+		if i < len(onsets)-1 {
+			end = onsets[i+1]
+		}
+		segments = append(segments, models.AudioSegment{
+			Start:    float64(start) / sampleRate,
+			End:      float64(end) / sampleRate,
+			Duration: float64(end-start) / sampleRate,
+		})
+	}
+	log.Debugf("segments: %+v", segments)
+	return
+}
+
+// Detect returns the sample positions of the onsets in mono samples
+func Detect(samples []float64, sampleRate int, opts Options) (onsets []int, err error) {
+	opts = opts.orDefault()
+	odf, err := Strength(samples, opts.Method)
+	if err != nil {
+		return
+	}
+
+	minFrames := int(opts.MinInterval * float64(sampleRate) / hop)
+	lastFrame := -minFrames - 1
+	for i := range odf {
+		if !isPeak(odf, i) || odf[i]-median(odf, i) < opts.Threshold {
+			continue
+		}
+		if level(samples, i*hop) < opts.Silence {
+			continue
+		}
+		if i-lastFrame <= minFrames {
+			continue
+		}
+		lastFrame = i
+
+		position := i * hop
+		if opts.Backtrack {
+			position = zeroCrossingBefore(samples, attack(samples, position))
+		}
+		if len(onsets) > 0 && position <= onsets[len(onsets)-1] {
+			continue
+		}
+		onsets = append(onsets, position)
+	}
+	log.Debugf("found %d onsets", len(onsets))
+	return
+}
+
+// Strength returns the onset detection function for every Hop samples,
+// scaled so that its maximum is 1
+func Strength(samples []float64, method string) (odf []float64, err error) {
+	odf, err = detectionFunction(samples, method)
+	if err != nil {
+		return
+	}
+	max := 0.0
+	for _, v := range odf {
+		max = math.Max(max, v)
+	}
+	if max == 0 {
+		return
+	}
+	for i := range odf {
+		odf[i] /= max
+	}
+	return
+}
+
+// detectionFunction returns the onset detection function for frames
+// centered on every hop
+func detectionFunction(samples []float64, method string) (odf []float64, err error) {
+	switch method {
+	case SpectralFlux, HFC, Complex:
+	default:
+		err = fmt.Errorf("unknown onset method '%s', use one of %+v", method, Methods)
+		return
+	}
+
+	window := hann(frameSize)
+	bins := frameSize/2 + 1
+	previous := make([]complex128, bins)
+	previous2 := make([]complex128, bins)
+	x := make([]complex128, frameSize)
+	for center := 0; center < len(samples); center += hop {
+		for j := range x {
+			k := center - frameSize/2 + j
+			x[j] = 0
+			if k >= 0 && k < len(samples) {
+				x[j] = complex(samples[k]*window[j], 0)
+			}
+		}
+		fft(x)
+
+		value := 0.0
+		for k := 0; k < bins; k++ {
+			// log compression evens out loud and quiet onsets
+			magnitude := math.Log1p(100 * cmplx.Abs(x[k]))
+			switch method {
+			case SpectralFlux:
+				value += math.Max(0, magnitude-real(previous[k]))
+			case HFC:
+				value += float64(k) * magnitude * magnitude
+			case Complex:
+				phase := 2*cmplx.Phase(previous[k]) - cmplx.Phase(previous2[k])
+				predicted := cmplx.Rect(cmplx.Abs(previous[k]), phase)
+				current := cmplx.Rect(magnitude, cmplx.Phase(x[k]))
+				// only rising energy counts as an onset
+				if magnitude >= cmplx.Abs(previous[k]) {
+					value += cmplx.Abs(current - predicted)
+				}
+			}
+			previous2[k] = previous[k]
+			if method == Complex {
+				previous[k] = cmplx.Rect(magnitude, cmplx.Phase(x[k]))
+			} else {
+				previous[k] = complex(magnitude, 0)
+			}
+		}
+		odf = append(odf, value)
+	}
+
+	if method == HFC {
+		// onsets are where the energy rises
+		for i := len(odf) - 1; i > 0; i-- {
+			odf[i] = math.Max(0, odf[i]-odf[i-1])
+		}
+		if len(odf) > 0 {
+			odf[0] = 0
+		}
+	}
+	return
+}
+
+func isPeak(odf []float64, i int) bool {
+	if odf[i] == 0 {
+		return false
+	}
+	for j := i - 2; j <= i+2; j++ {
+		if j < 0 || j >= len(odf) || j == i {
+			continue
+		}
+		if odf[j] > odf[i] || (j < i && odf[j] == odf[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func median(odf []float64, i int) float64 {
+	var values []float64
+	for j := i - medianBefore; j <= i+medianAfter; j++ {
+		if j >= 0 && j < len(odf) {
+			values = append(values, odf[j])
+		}
+	}
+	sort.Float64s(values)
+	return values[len(values)/2]
+}
+
+// level returns the loudest level in dB of the frame after a position
+func level(samples []float64, position int) float64 {
+	max := 0.0
+	for i := position; i < position+frameSize && i < len(samples); i++ {
+		max = math.Max(max, math.Abs(samples[i]))
+	}
+	return 20 * math.Log10(max)
+}
+
+// attack returns the position of the largest rise in level within the
+// frame around a position
+func attack(samples []float64, center int) (position int) {
+	const block = 64
+	position = center
+	bestRise := 0.0
+	for p := center - frameSize/2; p < center+frameSize/2; p += block / 4 {
+		if p-block < 0 || p+block > len(samples) {
+			continue
+		}
+		rise := math.Log((energy(samples[p:p+block]) + 1e-10) / (energy(samples[p-block:p]) + 1e-10))
+		if rise > bestRise {
+			bestRise = rise
+			position = p
+		}
+	}
+	return
+}
+
+func energy(samples []float64) (e float64) {
+	for _, x := range samples {
+		e += x * x
+	}
+	return
+}
+
+// zeroCrossingBefore returns the last zero crossing at or before a position,
+// looking back at most one frame
+func zeroCrossingBefore(samples []float64, position int) int {
+	if position >= len(samples) {
+		position = len(samples) - 1
+	}
+	for i := position; i > 0 && i > position-frameSize; i-- {
+		if samples[i] == 0 || (samples[i-1] < 0) != (samples[i] < 0) {
+			return i
+		}
+	}
+	return position
+}
@@ -0,0 +1,95 @@
+package onset
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hits makes decaying tones with a noisy attack at the given seconds
+func hits(seconds []float64, amplitudes []float64, length float64) (samples []float64) {
+	r := rand.New(rand.NewSource(1))
+	samples = make([]float64, int(length*sampleRate))
+	for h, start := range seconds {
+		first := int(start * sampleRate)
+		for i := first; i < len(samples); i++ {
+			t := float64(i-first) / sampleRate
+			noise := (r.Float64()*2 - 1) * math.Exp(-t*60)
+			samples[i] += amplitudes[h] * (0.5*math.Sin(2*math.Pi*(100+50*float64(h))*t) + noise) * math.Exp(-t*8)
+		}
+	}
+	return
+}
+
+func TestDetect(t *testing.T) {
+	seconds := []float64{0.1, 0.5, 0.9, 1.3}
+	samples := hits(seconds, []float64{1, 0.8, 0.2, 0.6}, 2)
+	for _, method := range Methods {
+		opts := DefaultOptions
+		opts.Method = method
+		onsets, err := Detect(samples, sampleRate, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, len(seconds), len(onsets), method)
+		for i := range onsets {
+			if i < len(seconds) {
+				// backtracking starts a bit early, never late
+				assert.InDelta(t, seconds[i]-0.003, float64(onsets[i])/sampleRate, 0.003, method)
+			}
+		}
+	}
+
+	// onsets start at zero crossings
+	onsets, err := Detect(samples, sampleRate, Options{})
+	assert.Nil(t, err)
+	for _, onset := range onsets {
+		assert.True(t, samples[onset] == 0 || (samples[onset-1] < 0) != (samples[onset] < 0))
+	}
+
+	// close onsets are merged
+	samples = hits([]float64{0.1, 0.15, 0.5}, []float64{1, 1, 1}, 1)
+	onsets, err = Detect(samples, sampleRate, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(onsets))
+	opts := DefaultOptions
+	opts.MinInterval = 0.01
+	onsets, err = Detect(samples, sampleRate, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(onsets))
+
+	// quiet onsets are ignored
+	samples = hits([]float64{0.1, 1.5}, []float64{1, 0.005}, 2)
+	onsets, err = Detect(samples, sampleRate, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(onsets))
+
+	onsets, err = Detect(make([]float64, sampleRate), sampleRate, Options{})
+	assert.Nil(t, err)
+	assert.Empty(t, onsets)
+
+	_, err = Detect(samples, sampleRate, Options{Method: "energy"})
+	assert.NotNil(t, err)
+
+	// empty fields are the defaults
+	onsets, err = Detect(samples, sampleRate, Options{Threshold: 0.3})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(onsets))
+	assert.Equal(t, Options{Method: SpectralFlux, Threshold: 0.3, MinInterval: 0.1, Silence: -40}, Options{Threshold: 0.3}.orDefault())
+}
+
+func TestFFT(t *testing.T) {
+	x := make([]complex128, 16)
+	for i := range x {
+		x[i] = complex(math.Cos(2*math.Pi*3*float64(i)/16), 0)
+	}
+	fft(x)
+	for k := range x {
+		expected := 0.0
+		if k == 3 || k == 13 {
+			expected = 8
+		}
+		assert.InDelta(t, expected, real(x[k]), 1e-9)
+		assert.InDelta(t, 0, imag(x[k]), 1e-9)
+	}
+}
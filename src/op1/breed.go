@@ -0,0 +1,146 @@
+package op1
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// categorical lists of allowed values have fewer values than this, and
+// their values are chosen at random instead of stepped
+const categorical = 16
+
+// mutationStep is the standard deviation of a mutation, as part of the
+// allowed values
+const mutationStep = 0.1
+
+// Mutate returns a copy of the patch where each engine, adsr, fx and lfo
+// parameter is changed with a probability of rate to a nearby allowed value.
+// Parameters without allowed values are kept.
+func (s SynthPatch) Mutate(r *rand.Rand, rate float64) SynthPatch {
+	mutate := func(values []int, allowed [][]int) {
+		for i := range allowed {
+			if i < len(values) && len(allowed[i]) > 1 && r.Float64() < rate {
+				values[i] = mutateValue(r, values[i], allowed[i])
+			}
+		}
+	}
+	mutate(s.Adsr[:], AllowedADSR)
+	mutate(s.Knobs[:], allowedParameters(AllowedEngine, s.Type))
+	mutate(s.FxParams[:], allowedParameters(AllowedEffects, s.FxType))
+	mutate(s.LfoParams[:], allowedParameters(AllowedLFO, s.LfoType))
+	s.Name = strings.Split(s.Encode(), "-")[0]
+	return s
+}
+
+// mutateValue steps from the value to another allowed value
+func mutateValue(r *rand.Rand, value int, allowed []int) int {
+	if len(allowed) < categorical {
+		return allowed[r.Intn(len(allowed))]
+	}
+	// start from the closest allowed value
+	index := nearestIndex(value, allowed)
+	step := int(math.Round(r.NormFloat64() * mutationStep * float64(len(allowed))))
+	if step == 0 {
+		step = 1
+		if r.Intn(2) == 0 {
+			step = -1
+		}
+	}
+	index += step
+	if index < 0 {
+		index = 0
+	} else if index >= len(allowed) {
+		index = len(allowed) - 1
+	}
+	return allowed[index]
+}
+
+// nearestIndex returns the index of the allowed value closest to the value
+func nearestIndex(value int, allowed []int) (index int) {
+	for i, v := range allowed {
+		if math.Abs(float64(v-value)) < math.Abs(float64(allowed[index]-value)) {
+			index = i
+		}
+	}
+	return
+}
+
+// allowedParameters returns the allowed values of the setting with the name
+func allowedParameters(settings []Setting, name string) [][]int {
+	for _, setting := range settings {
+		if setting.Name == name {
+			return setting.Parameters
+		}
+	}
+	return nil
+}
+
+// hasSetting returns whether there is a setting with the name
+func hasSetting(settings []Setting, name string) bool {
+	for _, setting := range settings {
+		if setting.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Crossover returns a child that takes its engine, adsr, fx and lfo each
+// from one of the parents
+func Crossover(r *rand.Rand, a SynthPatch, b SynthPatch) (child SynthPatch) {
+	child = a
+	if r.Intn(2) == 1 {
+		child.Type, child.Knobs, child.BaseFreq, child.SynthVersion = b.Type, b.Knobs, b.BaseFreq, b.SynthVersion
+	}
+	if r.Intn(2) == 1 {
+		child.Adsr = b.Adsr
+	}
+	if r.Intn(2) == 1 {
+		child.FxType, child.FxActive, child.FxParams = b.FxType, b.FxActive, b.FxParams
+	}
+	if r.Intn(2) == 1 {
+		child.LfoType, child.LfoActive, child.LfoParams = b.LfoType, b.LfoActive, b.LfoParams
+	}
+	child.Name = strings.Split(child.Encode(), "-")[0]
+	return
+}
+
+// Breed returns n children of one or two parents. Children of two parents
+// are crossed over, and every child is mutated with a probability of rate
+// per parameter. The same seed returns the same children.
+func Breed(parents []SynthPatch, n int, seed int64, rate float64) (children []SynthPatch, err error) {
+	if len(parents) < 1 || len(parents) > 2 {
+		err = fmt.Errorf("need one or two parents, not %d", len(parents))
+		return
+	}
+	if n < 1 {
+		err = fmt.Errorf("need at least 1 child, not %d", n)
+		return
+	}
+	if rate < 0 || rate > 1 {
+		err = fmt.Errorf("mutation rate %g should be from 0 to 1", rate)
+		return
+	}
+	for i, parent := range parents {
+		if parent.Type == "drum" {
+			err = fmt.Errorf("parent %d is a drum patch", i+1)
+			return
+		}
+		if err = parent.Check(); err != nil {
+			err = fmt.Errorf("parent %d: %s", i+1, err.Error())
+			return
+		}
+	}
+	r := rand.New(rand.NewSource(seed))
+	children = make([]SynthPatch, n)
+	for i := range children {
+		child := parents[0]
+		if len(parents) == 2 {
+			child = Crossover(r, parents[0], parents[1])
+		}
+		children[i] = child.Mutate(r, rate)
+	}
+	return
+}
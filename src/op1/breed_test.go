@@ -0,0 +1,85 @@
+package op1
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutate(t *testing.T) {
+	// knobs away from their bounds always change
+	parent, err := ReadSynthPatch("reverse/engines/cluster1.aif")
+	assert.Nil(t, err)
+	assert.Nil(t, parent.Check())
+	r := rand.New(rand.NewSource(1))
+
+	same := parent.Mutate(r, 0)
+	assert.Equal(t, parent.Knobs, same.Knobs)
+	assert.Equal(t, parent.Adsr, same.Adsr)
+
+	changed := 0
+	for i := 0; i < 20; i++ {
+		child := parent.Mutate(r, 1)
+		assert.Nil(t, child.Check())
+		assert.Equal(t, parent.Type, child.Type)
+		if child.Knobs != parent.Knobs {
+			changed++
+		}
+		for j := range AllowedADSR {
+			assert.True(t, Has(AllowedADSR[j], child.Adsr[j]))
+		}
+	}
+	assert.Equal(t, 20, changed)
+
+	// steps are small for long ranges
+	assert.InDelta(t, 8000, mutateValue(r, 8000, Range(0, 16000, 1)), 16000*5*mutationStep)
+	assert.Contains(t, []int{1, 2, 3}, mutateValue(r, 2, []int{1, 2, 3}))
+}
+
+func TestCrossover(t *testing.T) {
+	a, err := ReadSynthPatch("reverse/engines/cluster0.aif")
+	assert.Nil(t, err)
+	b, err := ReadSynthPatch("reverse/engines/dna_max.aif")
+	assert.Nil(t, err)
+	r := rand.New(rand.NewSource(1))
+	types := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		child := Crossover(r, a, b)
+		types[child.Type] = true
+		if child.Type == a.Type {
+			assert.Equal(t, a.Knobs, child.Knobs)
+		} else {
+			assert.Equal(t, b.Knobs, child.Knobs)
+		}
+		assert.Contains(t, [][8]int{a.Adsr, b.Adsr}, child.Adsr)
+		assert.Contains(t, [][8]int{a.FxParams, b.FxParams}, child.FxParams)
+	}
+	assert.Equal(t, map[string]bool{"cluster": true, "dna": true}, types)
+}
+
+func TestBreed(t *testing.T) {
+	a, err := ReadSynthPatch("reverse/engines/cluster0.aif")
+	assert.Nil(t, err)
+	b, err := ReadSynthPatch("reverse/engines/dna_max.aif")
+	assert.Nil(t, err)
+	children, err := Breed([]SynthPatch{a, b}, 10, 42, 0.2)
+	assert.Nil(t, err)
+	assert.Len(t, children, 10)
+	again, err := Breed([]SynthPatch{a, b}, 10, 42, 0.2)
+	assert.Nil(t, err)
+	assert.Equal(t, children, again)
+	for _, child := range children {
+		assert.Nil(t, child.Check())
+	}
+
+	_, err = Breed(nil, 10, 42, 0.2)
+	assert.NotNil(t, err)
+	_, err = Breed([]SynthPatch{a}, 10, 42, 2)
+	assert.NotNil(t, err)
+	_, err = Breed([]SynthPatch{a}, -1, 42, 0.2)
+	assert.NotNil(t, err)
+	a.Octave = 5
+	_, err = Breed([]SynthPatch{a}, 10, 42, 0.2)
+	assert.NotNil(t, err)
+}
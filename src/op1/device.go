@@ -0,0 +1,136 @@
+package op1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Device describes what a target device accepts in a patch
+type Device struct {
+	Name       string
+	SampleRate int
+	Channels   int
+	// DrumSeconds is the maximum length of a drum patch
+	DrumSeconds float64
+	// SynthSeconds is the maximum length of a sampler patch
+	SynthSeconds float64
+	// Keys is the number of slices in a drum patch
+	Keys int
+	// DrumVersion and SynthVersion are written into the metadata
+	DrumVersion  int
+	SynthVersion int
+	// SampleConversion converts a sample position into drum start/end units
+	SampleConversion int64
+}
+
+var (
+	OP1 = Device{
+		Name:             "op-1",
+		SampleRate:       44100,
+		Channels:         1,
+		DrumSeconds:      12,
+		SynthSeconds:     5.75,
+		Keys:             NUMKEYS,
+		DrumVersion:      2,
+		SynthVersion:     1,
+		SampleConversion: SAMPLECONVERSION,
+	}
+	OPZ = Device{
+		Name:             "op-z",
+		SampleRate:       44100,
+		Channels:         1,
+		DrumSeconds:      12,
+		SynthSeconds:     6,
+		Keys:             NUMKEYS,
+		DrumVersion:      2,
+		SynthVersion:     1,
+		SampleConversion: SAMPLECONVERSION,
+	}
+	// the op-1 field keeps stereo and allows longer samples
+	OP1Field = Device{
+		Name:             "op-1-field",
+		SampleRate:       44100,
+		Channels:         2,
+		DrumSeconds:      20,
+		SynthSeconds:     20,
+		Keys:             NUMKEYS,
+		DrumVersion:      3,
+		SynthVersion:     3,
+		SampleConversion: 2434, // floor(2147483646/(44100*20)), so 20 seconds fit
+	}
+)
+
+// Devices are all the known devices
+var Devices = []Device{OP1, OPZ, OP1Field}
+
+// DeviceNames returns the names of all devices
+func DeviceNames() (names []string) {
+	for _, d := range Devices {
+		names = append(names, d.Name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// GetDevice returns the device with the given name, ignoring case and dashes.
+// An empty name is the op-1.
+func GetDevice(name string) (d Device, err error) {
+	if name == "" {
+		return OP1, nil
+	}
+	simplify := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("-", "", "_", "", " ", "").Replace(s))
+	}
+	for _, d = range Devices {
+		if simplify(d.Name) == simplify(name) {
+			return
+		}
+	}
+	err = fmt.Errorf("unknown device '%s', use one of %s", name, strings.Join(DeviceNames(), ", "))
+	return
+}
+
+// MaxDrumSamples is the number of samples that fit into a drum patch, with
+// their positions at most MAXENDPOINT
+func (d Device) MaxDrumSamples() int64 {
+	samples := int64(d.DrumSeconds * float64(d.SampleRate))
+	if samples*d.SampleConversion > MAXENDPOINT {
+		samples = MAXENDPOINT / d.SampleConversion
+	}
+	return samples
+}
+
+// DrumDeviceNames are the names of the devices that write drum patches of
+// the version, like "op-1/op-z"
+func DrumDeviceNames(version int) string {
+	var names []string
+	for _, d := range Devices {
+		if d.DrumVersion == version {
+			names = append(names, d.Name)
+		}
+	}
+	if len(names) == 0 {
+		return "unknown device"
+	}
+	return strings.Join(names, "/")
+}
+
+// drumDevice guesses the device of a drum patch from its version, as the
+// op-1 and op-z write the same metadata
+func drumDevice(version int) Device {
+	for _, d := range Devices {
+		if d.DrumVersion == version {
+			return d
+		}
+	}
+	return OP1
+}
+
+// orDefault returns the op-1 for devices that were never set
+func (d Device) orDefault() Device {
+	if d.Name == "" {
+		return OP1
+	}
+	return d
+}
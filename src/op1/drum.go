@@ -1,16 +1,11 @@
 package op1
 
 import (
-	"bytes"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"math"
-	"os/exec"
 	"strings"
 
-	"github.com/schollz/logger"
+	"github.com/schollz/teoperator/src/audio"
 )
 
 var defaultDrumPatch DrumPatch
@@ -42,100 +37,227 @@ type DrumPatch struct {
 	Start       []int64 `json:"start"`
 	Type        string  `json:"type"`
 	Volume      []int64 `json:"volume"`
+
+	// Device is the target device, the op-1 if not set
+	Device Device `json:"-"`
+	// Normalization levels the audio in Normalize, nothing if not set
+	Normalization audio.Normalization `json:"-"`
 }
 
 // NewDrumPatch returns a new DrumPatch with correct defaults
 func NewDrumPatch() DrumPatch {
-	return defaultDrumPatch
+	return defaultDrumPatch.Copy()
 }
 
-// Save creates a drum patch from op1 meta data and a song clip
-func (drumpatch *DrumPatch) Save(audioClip string, fnameOut string) (err error) {
-	if !strings.HasSuffix(fnameOut, ".aif") {
-		err = fmt.Errorf("%s does not have .aif", fnameOut)
-		return
+// SetDevice sets the target device along with its metadata version
+func (drumpatch *DrumPatch) SetDevice(d Device) {
+	drumpatch.Device = d
+	drumpatch.DrumVersion = d.DrumVersion
+}
+
+// Copy returns a DrumPatch that does not share any arrays
+func (drumpatch DrumPatch) Copy() DrumPatch {
+	for _, a := range []*[]int64{&drumpatch.DynaEnv, &drumpatch.End, &drumpatch.FxParams,
+		&drumpatch.LfoParams, &drumpatch.Pitch, &drumpatch.Playmode, &drumpatch.Reverse,
+		&drumpatch.Start, &drumpatch.Volume} {
+		*a = append([]int64{}, (*a)...)
 	}
-	// generate a merged audio waveform, downsampled to 1 channel
-	cmd := []string{"-y", "-i", audioClip, "-ss", "0", "-to", "12", "-ar", "44100", "-ac", "1", fnameOut}
-	logger.Debug(cmd)
-	out, err := exec.Command("ffmpeg", cmd...).CombinedOutput()
+	return drumpatch
+}
+
+// ReadDrumPatch reads the metadata of a drum patch
+func ReadDrumPatch(fname string) (dp DrumPatch, err error) {
+	patchType, err := readMetadata(fname, &dp)
 	if err != nil {
-		logger.Errorf("ffmpeg: %s", out)
 		return
 	}
+	dp.Device = drumDevice(dp.DrumVersion)
+	if patchType != "drum" {
+		err = fmt.Errorf("'%s' is a %s patch, not a drum patch", fname, patchType)
+	}
+	return
+}
 
-	// inject the OP-1 metadata before teh SSND tag
-	b, err := ioutil.ReadFile(fnameOut)
-	if err != nil {
-		return
+// Violation is a value of a drum patch that the op-1 does not accept.
+// Key is numbered 1-24, or 0 if the violation is not specific to a key.
+type Violation struct {
+	Key     int
+	Field   string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Key == 0 {
+		return fmt.Sprintf("%s: %s", v.Field, v.Message)
 	}
+	return fmt.Sprintf("key %d %s: %s", v.Key, v.Field, v.Message)
+}
 
-	ssndTagPosition := bytes.Index(b, []byte("SSND"))
-	if ssndTagPosition < 0 {
-		err = fmt.Errorf("no SND tag")
-		return
+// Violations is the error returned by DrumPatch.Check
+type Violations []Violation
+
+func (v Violations) Error() string {
+	s := make([]string, len(v))
+	for i := range v {
+		s[i] = v[i].String()
 	}
+	return "invalid drum patch: " + strings.Join(s, "; ")
+}
 
-	// normalize drumpatch, all the start/stop blocks need to be factors of 8192
-	for i := range drumpatch.End {
-		drumpatch.End[i] = drumpatch.End[i] * 8192 / 8192
-		if drumpatch.End[i] > MAXENDPOINT {
-			drumpatch.End[i] = MAXENDPOINT
+// Check will return Violations if any of the values are out of range
+func (drumpatch DrumPatch) Check() (err error) {
+	numKeys := drumpatch.Device.orDefault().Keys
+	var v Violations
+	add := func(key int, field string, format string, a ...interface{}) {
+		v = append(v, Violation{Key: key, Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+
+	// check array lengths, the firmware expects one value per key
+	keyArrays := []struct {
+		field  string
+		values []int64
+	}{
+		{"start", drumpatch.Start},
+		{"end", drumpatch.End},
+		{"pitch", drumpatch.Pitch},
+		{"playmode", drumpatch.Playmode},
+		{"reverse", drumpatch.Reverse},
+		{"volume", drumpatch.Volume},
+	}
+	for _, a := range keyArrays {
+		if len(a.values) != numKeys {
+			add(0, a.field, "has %d entries, needs %d", len(a.values), numKeys)
 		}
-		if drumpatch.End[i] < 0 {
-			drumpatch.End[i] = 0
+	}
+	for _, a := range []struct {
+		field  string
+		values []int64
+	}{
+		{"dyna_env", drumpatch.DynaEnv},
+		{"fx_params", drumpatch.FxParams},
+		{"lfo_params", drumpatch.LfoParams},
+	} {
+		if len(a.values) != 8 {
+			add(0, a.field, "has %d entries, needs 8", len(a.values))
 		}
 	}
-	for i := range drumpatch.Start {
-		drumpatch.Start[i] = drumpatch.Start[i] * 8192 / 8192
-		if drumpatch.Start[i] > MAXENDPOINT {
-			drumpatch.Start[i] = MAXENDPOINT
+	if len(v) > 0 {
+		err = v
+		return
+	}
+
+	if drumpatch.Type != "drum" {
+		add(0, "type", "is '%s', needs 'drum'", drumpatch.Type)
+	}
+	if !hasString(FxTypes, drumpatch.FxType) {
+		add(0, "fx_type", "'%s' is unknown", drumpatch.FxType)
+	}
+	if !hasString(LfoTypes, drumpatch.LfoType) {
+		add(0, "lfo_type", "'%s' is unknown", drumpatch.LfoType)
+	}
+	if drumpatch.Octave < -4 || drumpatch.Octave > 4 {
+		add(0, "octave", "%d is out of range", drumpatch.Octave)
+	}
+
+	// check each key
+	for i := 0; i < numKeys; i++ {
+		key := i + 1
+		if drumpatch.Start[i] < 0 || drumpatch.Start[i] > MAXENDPOINT {
+			add(key, "start", "%d is out of range", drumpatch.Start[i])
+		}
+		if drumpatch.End[i] < 0 || drumpatch.End[i] > MAXENDPOINT {
+			add(key, "end", "%d is out of range", drumpatch.End[i])
 		}
-		if drumpatch.Start[i] < 0 {
-			drumpatch.Start[i] = 0
+		if drumpatch.Start[i] > drumpatch.End[i] {
+			add(key, "start", "%d is after end %d", drumpatch.Start[i], drumpatch.End[i])
+		}
+		if drumpatch.Pitch[i] < -MaxPitch*PitchPerSemitone || drumpatch.Pitch[i] > MaxPitch*PitchPerSemitone {
+			add(key, "pitch", "%d is out of range", drumpatch.Pitch[i])
+		}
+		if drumpatch.Volume[i] < 0 || drumpatch.Volume[i] > MaxVolume*VolumeDefault/100 {
+			add(key, "volume", "%d is out of range", drumpatch.Volume[i])
+		}
+		if drumpatch.Reverse[i] != ReverseOff && drumpatch.Reverse[i] != ReverseOn {
+			add(key, "reverse", "%d is unknown", drumpatch.Reverse[i])
+		}
+		knownPlaymode := false
+		for _, playmode := range Playmodes {
+			knownPlaymode = knownPlaymode || drumpatch.Playmode[i] == playmode
+		}
+		if !knownPlaymode {
+			add(key, "playmode", "%d is unknown", drumpatch.Playmode[i])
 		}
 	}
 
-	op1dataBytes, err := json.Marshal(drumpatch)
+	if len(v) > 0 {
+		err = v
+	}
+	return
+}
+
+// Save creates a drum patch from op1 meta data and a song clip
+func (drumpatch *DrumPatch) Save(audioClip string, fnameOut string) (err error) {
+	b, err := audio.Decode(audioClip)
 	if err != nil {
 		return
 	}
+	return drumpatch.SaveBuffer(b, fnameOut)
+}
 
-	// filler is to pad the aif file so that it is a multiple of 4
-	filler := []byte{10}
-	for {
-		b2 := append([]byte{}, b[:ssndTagPosition]...)
-		// 4 bytes for AAPL tag, required to initiate op-1 data
-		b2 = append(b2, []byte{65, 80, 80, 76}...)
-		// 4 bytes to delcare size
-		bsSize := make([]byte, 4)
-		binary.BigEndian.PutUint32(bsSize, uint32(4+len(filler)+len(op1dataBytes)))
-		b2 = append(b2, bsSize...)
-		// 4 bytes to write magic op-1
-		b2 = append(b2, []byte{111, 112, 45, 49}...)
-		// write the op1 meta data
-		b2 = append(b2, op1dataBytes...)
-		// add filler
-		b2 = append(b2, filler...)
-		// write the rest of the bytes
-		b2 = append(b2, b[ssndTagPosition:]...)
-
-		// set bytes 4-8 with the total size - 8 bytes
-		totalsize := len(b2) - 8
-		bsTotalSize := make([]byte, 4)
-		binary.BigEndian.PutUint32(bsTotalSize, uint32(totalsize))
-		b3 := append([]byte{}, b2[:4]...)
-		b3 = append(b3, bsTotalSize...)
-		b3 = append(b3, b2[8:]...)
-
-		// repeat until the the total bytes is a multiple of 4
-		if math.Mod(float64(totalsize), 4.0) == 0 {
-			err = ioutil.WriteFile(fnameOut, b3, 0644)
-			break
-		} else {
-			filler = append(filler, []byte{30}...)
-		}
+// SaveBuffer creates a drum patch from op1 meta data and decoded audio
+func (drumpatch *DrumPatch) SaveBuffer(b *audio.Buffer, fnameOut string) (err error) {
+	if !strings.HasSuffix(fnameOut, ".aif") {
+		err = fmt.Errorf("%s does not have .aif", fnameOut)
+		return
 	}
+	// validate the patch
+	if err = drumpatch.Check(); err != nil {
+		return
+	}
+
+	// inject the OP-1 metadata into the audio, resampled for the device
+	device := drumpatch.Device.orDefault()
+	b = b.Convert(device.SampleRate, device.Channels, device.DrumSeconds)
+	f := b.AIFF()
+	err = setMetadata(&f, drumpatch, 4)
+	if err != nil {
+		return
+	}
+	err = f.WriteFile(fnameOut)
+
+	return
+}
 
+// Normalize levels the audio as a whole, or each of the keys on its own
+// for per-slice normalization, with audio at the sample rate of the device.
+// Other keys are not leveled, as they might cut through sounds.
+func (drumpatch *DrumPatch) Normalize(b *audio.Buffer, keys []int) {
+	n := drumpatch.Normalization
+	if !n.PerSlice {
+		n.Apply(b)
+		return
+	}
+	starts, ends := drumpatch.frames(keys)
+	n.ApplySlices(b, starts, ends)
+}
+
+// Declick removes clicks at the edges of the keys, with audio at the sample
+// rate of the device. Other keys are not faded, as they might not point to
+// the edges of sounds.
+func (drumpatch *DrumPatch) Declick(b *audio.Buffer, d audio.Declick, keys []int) {
+	starts, ends := drumpatch.frames(keys)
+	d.ApplySlices(b, starts, ends)
+}
+
+// frames returns the start and end frames of the keys
+func (drumpatch *DrumPatch) frames(keys []int) (starts []int, ends []int) {
+	conversion := drumpatch.Device.orDefault().SampleConversion
+	for _, key := range keys {
+		if key < 0 || key >= len(drumpatch.Start) {
+			continue
+		}
+		starts = append(starts, int(drumpatch.Start[key]/conversion))
+		ends = append(ends, int(drumpatch.End[key]/conversion))
+	}
 	return
 }
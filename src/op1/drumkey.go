@@ -0,0 +1,299 @@
+package op1
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NUMKEYS is the number of keys in a drum patch
+const NUMKEYS = 24
+
+// values of the per-key arrays of a drum patch, as written by the op-1
+const (
+	ReverseOff = int64(8192)
+	ReverseOn  = int64(12288)
+
+	PlaymodeOneShot = int64(8192)
+	PlaymodeGate    = int64(12288)
+	PlaymodeLoop    = int64(16384)
+
+	// pitch is stored as 512 per semitone, 0 is the original pitch
+	PitchPerSemitone = int64(512)
+	MaxPitch         = 24
+
+	// volume is stored with 8192 as the original level
+	VolumeDefault = int64(8192)
+	MaxVolume     = 200
+)
+
+// Playmodes maps the names of the playmodes to their values
+var Playmodes = map[string]int64{
+	"oneshot": PlaymodeOneShot,
+	"gate":    PlaymodeGate,
+	"loop":    PlaymodeLoop,
+}
+
+func (dp *DrumPatch) checkKey(key int) (err error) {
+	if key < 0 || key >= dp.Device.orDefault().Keys || key >= len(dp.Start) {
+		err = fmt.Errorf("key %d is out of range", key+1)
+	}
+	return
+}
+
+// SetPitch sets the pitch of a key (0-23) in semitones (-24 to +24)
+func (dp *DrumPatch) SetPitch(key int, semitones int) (err error) {
+	if err = dp.checkKey(key); err != nil {
+		return
+	}
+	if semitones < -MaxPitch || semitones > MaxPitch {
+		err = fmt.Errorf("pitch %d is out of range for key %d", semitones, key+1)
+		return
+	}
+	dp.Pitch[key] = int64(semitones) * PitchPerSemitone
+	return
+}
+
+// SetVolume sets the volume of a key (0-23) in percent of the original level (0 to 200)
+func (dp *DrumPatch) SetVolume(key int, percent int) (err error) {
+	if err = dp.checkKey(key); err != nil {
+		return
+	}
+	if percent < 0 || percent > MaxVolume {
+		err = fmt.Errorf("volume %d is out of range for key %d", percent, key+1)
+		return
+	}
+	dp.Volume[key] = int64(percent) * VolumeDefault / 100
+	return
+}
+
+// SetReverse sets whether a key (0-23) plays backwards
+func (dp *DrumPatch) SetReverse(key int, reverse bool) (err error) {
+	if err = dp.checkKey(key); err != nil {
+		return
+	}
+	dp.Reverse[key] = ReverseOff
+	if reverse {
+		dp.Reverse[key] = ReverseOn
+	}
+	return
+}
+
+// SetPlaymode sets the playmode of a key (0-23) to "oneshot", "gate" or "loop"
+func (dp *DrumPatch) SetPlaymode(key int, playmode string) (err error) {
+	if err = dp.checkKey(key); err != nil {
+		return
+	}
+	value, ok := Playmodes[playmode]
+	if !ok {
+		err = fmt.Errorf("unknown playmode '%s' for key %d", playmode, key+1)
+		return
+	}
+	dp.Playmode[key] = value
+	return
+}
+
+// SetStart sets where a key (0-23) starts, in seconds of the audio
+func (dp *DrumPatch) SetStart(key int, seconds float64) (err error) {
+	if err = dp.checkKey(key); err != nil {
+		return
+	}
+	dp.Start[key], err = dp.position(key, seconds)
+	return
+}
+
+// SetEnd sets where a key (0-23) ends, in seconds of the audio
+func (dp *DrumPatch) SetEnd(key int, seconds float64) (err error) {
+	if err = dp.checkKey(key); err != nil {
+		return
+	}
+	dp.End[key], err = dp.position(key, seconds)
+	return
+}
+
+// position converts seconds into start/end units
+func (dp *DrumPatch) position(key int, seconds float64) (position int64, err error) {
+	device := dp.Device.orDefault()
+	if seconds < 0 || seconds > device.DrumSeconds {
+		err = fmt.Errorf("%g seconds is out of range for key %d", seconds, key+1)
+		return
+	}
+	samples := int64(math.Round(seconds * float64(device.SampleRate)))
+	if samples > device.MaxDrumSamples() {
+		// the end of the patch is the last sample that fits
+		samples = device.MaxDrumSamples()
+	}
+	position = samples * device.SampleConversion
+	return
+}
+
+// EditKeys applies key settings like "5:reverse,pitch=3,playmode=gate,volume=80"
+// or "5:start=1.2,end=1.5" where the key is numbered 1-24 and start and end
+// are in seconds. Multiple settings can be separated by spaces.
+func (dp *DrumPatch) EditKeys(specs ...string) (err error) {
+	for _, spec := range specs {
+		for _, field := range strings.Fields(spec) {
+			err = dp.editKey(field)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (dp *DrumPatch) editKey(spec string) (err error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		err = fmt.Errorf("key setting '%s' should look like '5:reverse,pitch=3'", spec)
+		return
+	}
+	key, err := strconv.Atoi(parts[0])
+	if err != nil {
+		err = fmt.Errorf("bad key in '%s'", spec)
+		return
+	}
+	key--
+	for _, option := range strings.Split(parts[1], ",") {
+		nameValue := strings.SplitN(option, "=", 2)
+		name := strings.ToLower(strings.TrimSpace(nameValue[0]))
+		value := ""
+		if len(nameValue) == 2 {
+			value = strings.TrimSpace(nameValue[1])
+		}
+		switch name {
+		case "reverse":
+			err = dp.SetReverse(key, true)
+		case "forward":
+			err = dp.SetReverse(key, false)
+		case "oneshot", "gate", "loop":
+			err = dp.SetPlaymode(key, name)
+		case "playmode":
+			err = dp.SetPlaymode(key, value)
+		case "start", "end":
+			var seconds float64
+			seconds, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				err = fmt.Errorf("bad %s in '%s'", name, spec)
+			} else if name == "start" {
+				err = dp.SetStart(key, seconds)
+			} else {
+				err = dp.SetEnd(key, seconds)
+			}
+		case "pitch", "volume":
+			var i int
+			i, err = strconv.Atoi(value)
+			if err != nil {
+				err = fmt.Errorf("bad %s in '%s'", name, spec)
+			} else if name == "pitch" {
+				err = dp.SetPitch(key, i)
+			} else {
+				err = dp.SetVolume(key, i)
+			}
+		default:
+			err = fmt.Errorf("unknown key setting '%s'", option)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// SnapToZeroCrossings moves the start and end of every key to the nearest
+// zero crossing within window samples, so slices do not click. The samples
+// are the mono audio of the patch at the sample rate of its device.
+func (dp *DrumPatch) SnapToZeroCrossings(samples []float64, window int) {
+	if window <= 0 {
+		return
+	}
+	conversion := dp.Device.orDefault().SampleConversion
+	for _, positions := range [][]int64{dp.Start, dp.End} {
+		for i, position := range positions {
+			sample := int(position / conversion)
+			if sample <= 0 || sample >= len(samples) {
+				continue
+			}
+			positions[i] = int64(nearestZeroCrossing(samples, sample, window)) * conversion
+		}
+	}
+	for i := range dp.Start {
+		if dp.Start[i] > dp.End[i] {
+			dp.Start[i] = dp.End[i]
+		}
+	}
+}
+
+// nearestZeroCrossing returns the closest sample within the window that
+// starts a new sign, or the sample itself if there is none
+func nearestZeroCrossing(samples []float64, sample int, window int) int {
+	crossing := func(i int) bool {
+		return i > 0 && i < len(samples) && (samples[i] == 0 || (samples[i-1] < 0) != (samples[i] < 0))
+	}
+	for d := 0; d <= window; d++ {
+		if crossing(sample - d) {
+			return sample - d
+		}
+		if crossing(sample + d) {
+			return sample + d
+		}
+	}
+	return sample
+}
+
+// Key is the settings of a key of a drum patch in readable units
+type Key struct {
+	// Start and End are in seconds
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	// Pitch is in semitones
+	Pitch float64 `json:"pitch"`
+	// Volume is in percent of the original level
+	Volume   float64 `json:"volume"`
+	Reverse  bool    `json:"reverse"`
+	Playmode string  `json:"playmode"`
+}
+
+// Key returns the settings of a key (0-23)
+func (dp DrumPatch) Key(key int) (k Key, err error) {
+	if err = dp.checkKey(key); err != nil {
+		return
+	}
+	for _, a := range [][]int64{dp.End, dp.Pitch, dp.Volume, dp.Reverse, dp.Playmode} {
+		if key >= len(a) {
+			err = fmt.Errorf("key %d is missing settings", key+1)
+			return
+		}
+	}
+	device := dp.Device.orDefault()
+	seconds := func(position int64) float64 {
+		return float64(position/device.SampleConversion) / float64(device.SampleRate)
+	}
+	k = Key{
+		Start:    seconds(dp.Start[key]),
+		End:      seconds(dp.End[key]),
+		Pitch:    float64(dp.Pitch[key]) / float64(PitchPerSemitone),
+		Volume:   float64(dp.Volume[key]) * 100 / float64(VolumeDefault),
+		Reverse:  dp.Reverse[key] == ReverseOn,
+		Playmode: strconv.FormatInt(dp.Playmode[key], 10),
+	}
+	for name, value := range Playmodes {
+		if dp.Playmode[key] == value {
+			k.Playmode = name
+		}
+	}
+	return
+}
+
+// Keys returns the settings of every key of the device
+func (dp DrumPatch) Keys() (keys []Key, err error) {
+	keys = make([]Key, dp.Device.orDefault().Keys)
+	for i := range keys {
+		keys[i], err = dp.Key(i)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
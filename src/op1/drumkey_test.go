@@ -0,0 +1,88 @@
+package op1
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditKeys(t *testing.T) {
+	dp := NewDrumPatch()
+	assert.Nil(t, dp.EditKeys("5:reverse,pitch=3,playmode=gate", "1:volume=50 24:loop,pitch=-24"))
+	assert.Equal(t, ReverseOn, dp.Reverse[4])
+	assert.Equal(t, 3*PitchPerSemitone, dp.Pitch[4])
+	assert.Equal(t, PlaymodeGate, dp.Playmode[4])
+	assert.Equal(t, VolumeDefault/2, dp.Volume[0])
+	assert.Equal(t, PlaymodeLoop, dp.Playmode[23])
+	assert.Equal(t, -24*PitchPerSemitone, dp.Pitch[23])
+
+	// the defaults are not changed
+	assert.Equal(t, ReverseOff, NewDrumPatch().Reverse[4])
+
+	assert.NotNil(t, dp.EditKeys("25:reverse"))
+	assert.NotNil(t, dp.EditKeys("0:reverse"))
+	assert.NotNil(t, dp.EditKeys("1:pitch=25"))
+	assert.NotNil(t, dp.EditKeys("1:volume=201"))
+	assert.NotNil(t, dp.EditKeys("1:playmode=bounce"))
+	assert.NotNil(t, dp.EditKeys("1:wobble"))
+	assert.NotNil(t, dp.EditKeys("reverse"))
+}
+
+func TestSnapToZeroCrossings(t *testing.T) {
+	// a 100 hz sine crosses zero every 220.5 samples
+	samples := make([]float64, 44100)
+	for i := range samples {
+		samples[i] = math.Sin(2 * math.Pi * 100 * float64(i) / 44100)
+	}
+	isCrossing := func(position int64) bool {
+		i := position / SAMPLECONVERSION
+		return position%SAMPLECONVERSION == 0 && (samples[i-1] < 0) != (samples[i] < 0)
+	}
+	dp := NewDrumPatch()
+	dp.Start[0] = 0
+	dp.End[0] = 1000 * SAMPLECONVERSION
+	dp.Start[1] = 1000 * SAMPLECONVERSION
+	dp.End[1] = 2000 * SAMPLECONVERSION
+	dp.Start[2] = 100000 * SAMPLECONVERSION
+	dp.End[2] = 100000 * SAMPLECONVERSION
+	dp.SnapToZeroCrossings(samples, 150)
+	assert.Equal(t, int64(0), dp.Start[0])
+	assert.True(t, isCrossing(dp.End[0]))
+	assert.InDelta(t, 1000*SAMPLECONVERSION, dp.End[0], float64(111*SAMPLECONVERSION))
+	assert.Equal(t, dp.End[0], dp.Start[1])
+	assert.True(t, isCrossing(dp.End[1]))
+	assert.InDelta(t, 2000*SAMPLECONVERSION, dp.End[1], float64(111*SAMPLECONVERSION))
+	// past the end of the audio
+	assert.Equal(t, int64(100000)*SAMPLECONVERSION, dp.Start[2])
+
+	// too far away
+	dp.End[0] = 1000 * SAMPLECONVERSION
+	dp.SnapToZeroCrossings(samples, 10)
+	assert.Equal(t, int64(1000)*SAMPLECONVERSION, dp.End[0])
+}
+
+func TestKeys(t *testing.T) {
+	dp, err := ReadDrumPatch("tests/1.aif")
+	assert.Nil(t, err)
+	assert.Equal(t, OP1, dp.Device)
+	assert.Nil(t, dp.EditKeys("2:reverse,pitch=-3,volume=50,gate"))
+	keys, err := dp.Keys()
+	assert.Nil(t, err)
+	assert.Len(t, keys, NUMKEYS)
+	assert.Equal(t, Key{Start: 0, End: 0.5456, Pitch: 0, Volume: 100, Playmode: "oneshot"}, roundKey(keys[0]))
+	assert.Equal(t, Key{Start: 0.5456, End: 0.9229, Pitch: -3, Volume: 50, Reverse: true, Playmode: "gate"}, roundKey(keys[1]))
+
+	dp.Playmode[2] = 1
+	k, err := dp.Key(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", k.Playmode)
+	_, err = dp.Key(24)
+	assert.NotNil(t, err)
+}
+
+func roundKey(k Key) Key {
+	k.Start = math.Round(k.Start*10000) / 10000
+	k.End = math.Round(k.End*10000) / 10000
+	return k
+}
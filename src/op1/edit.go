@@ -0,0 +1,171 @@
+package op1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/schollz/teoperator/src/aiff"
+	"gopkg.in/yaml.v3"
+)
+
+// Changes are edits of the metadata of a patch
+type Changes struct {
+	// Fields are new values of metadata fields by their json name,
+	// like "fx_type" or "base_freq"
+	Fields map[string]json.RawMessage
+	// Keys are key settings of drum patches, see DrumPatch.EditKeys
+	Keys []string
+}
+
+// ParseChanges reads changes from a json or yaml object of metadata fields,
+// where "keys" is a list of key settings:
+//
+//	fx_type: cwo
+//	keys: ["5:end=1.5", "6:reverse"]
+func ParseChanges(data []byte) (c Changes, err error) {
+	// json is yaml, so both are read as yaml and converted to json
+	var fields map[string]interface{}
+	err = yaml.Unmarshal(data, &fields)
+	if err != nil {
+		err = fmt.Errorf("could not parse changes: %s", err.Error())
+		return
+	}
+	c.Fields = make(map[string]json.RawMessage)
+	for name, value := range fields {
+		if name == "keys" {
+			keys, ok := value.([]interface{})
+			if !ok {
+				err = fmt.Errorf("keys should be a list like [\"5:reverse\"]")
+				return
+			}
+			for _, key := range keys {
+				c.Keys = append(c.Keys, fmt.Sprint(key))
+			}
+			continue
+		}
+		c.Fields[name], err = json.Marshal(value)
+		if err != nil {
+			err = fmt.Errorf("bad value for %s: %s", name, err.Error())
+			return
+		}
+	}
+	return
+}
+
+// ReadChanges reads changes from a json or yaml file
+func ReadChanges(fname string) (c Changes, err error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return
+	}
+	c, err = ParseChanges(data)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", fname, err.Error())
+	}
+	return
+}
+
+// Set adds a change like "octave=1" or "fx_type=cwo". Values that are not
+// json are strings.
+func (c *Changes) Set(s string) (err error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		err = fmt.Errorf("change '%s' should look like 'name=value'", s)
+		return
+	}
+	value := []byte(parts[1])
+	if !json.Valid(value) {
+		value = []byte(strconv.Quote(parts[1]))
+	}
+	if c.Fields == nil {
+		c.Fields = make(map[string]json.RawMessage)
+	}
+	c.Fields[strings.TrimSpace(parts[0])] = value
+	return
+}
+
+// Apply changes a *DrumPatch or *SynthPatch
+func (c Changes) Apply(patch interface{}) (err error) {
+	names := make([]string, 0, len(c.Fields))
+	for name := range c.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, _ := json.Marshal(map[string]json.RawMessage{name: c.Fields[name]})
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(patch); err != nil {
+			err = fmt.Errorf("bad change of %s: %s", name, err.Error())
+			return
+		}
+	}
+	switch p := patch.(type) {
+	case *DrumPatch:
+		err = p.EditKeys(c.Keys...)
+	case *SynthPatch:
+		if len(c.Keys) > 0 {
+			err = fmt.Errorf("synth patches have no key settings")
+		} else if p.Type == "drum" {
+			err = fmt.Errorf("synth patches cannot become drum patches")
+		}
+	default:
+		err = fmt.Errorf("cannot change %T", patch)
+	}
+	return
+}
+
+// EditPatch changes the metadata of a patch and writes it to fnameOut,
+// which can be the same file. The audio is copied as it is.
+func EditPatch(fname string, fnameOut string, c Changes) (err error) {
+	patch, err := ReadPatch(fname)
+	if err != nil {
+		return
+	}
+	switch p := patch.(type) {
+	case DrumPatch:
+		err = c.Apply(&p)
+		patch = p
+	case SynthPatch:
+		err = c.Apply(&p)
+		patch = p
+	}
+	if err != nil {
+		return
+	}
+	err = WritePatch(fname, fnameOut, patch)
+	return
+}
+
+// WritePatch checks a DrumPatch or SynthPatch and writes it as the
+// metadata of the audio of fname into fnameOut
+func WritePatch(fname string, fnameOut string, patch interface{}) (err error) {
+	align := 2
+	switch p := patch.(type) {
+	case DrumPatch:
+		err = p.Check()
+		align = 4
+	case SynthPatch:
+		err = p.Check()
+	default:
+		err = fmt.Errorf("cannot write %T", patch)
+	}
+	if err != nil {
+		return
+	}
+	f, err := aiff.ReadFile(fname)
+	if err != nil {
+		return
+	}
+	err = setMetadata(&f, patch, align)
+	if err != nil {
+		return
+	}
+	err = f.WriteFile(fnameOut)
+	return
+}
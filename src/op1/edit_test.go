@@ -0,0 +1,86 @@
+package op1
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schollz/teoperator/src/aiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChanges(t *testing.T) {
+	fromJSON, err := ParseChanges([]byte(`{"fx_type": "cwo", "octave": 1, "keys": ["5:end=1.5"]}`))
+	assert.Nil(t, err)
+	fromYAML, err := ParseChanges([]byte("fx_type: cwo\noctave: 1\nkeys:\n  - 5:end=1.5\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, fromJSON, fromYAML)
+	assert.Equal(t, []string{"5:end=1.5"}, fromJSON.Keys)
+	assert.Equal(t, `"cwo"`, string(fromJSON.Fields["fx_type"]))
+
+	var c Changes
+	assert.Nil(t, c.Set("fx_type=cwo"))
+	assert.Nil(t, c.Set("octave=1"))
+	assert.NotNil(t, c.Set("octave"))
+	c.Keys = fromJSON.Keys
+	assert.Equal(t, fromJSON, c)
+
+	_, err = ParseChanges([]byte(`{"keys": "5:reverse"}`))
+	assert.NotNil(t, err)
+	_, err = ParseChanges([]byte(`[1, 2]`))
+	assert.NotNil(t, err)
+}
+
+func TestEditPatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "kit.aif")
+	data, err := ioutil.ReadFile("tests/1.aif")
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(fname, data, 0644))
+
+	c, err := ParseChanges([]byte(`{"fx_type": "cwo", "fx_active": true, "keys": ["5:end=1.7,reverse"]}`))
+	assert.Nil(t, err)
+	assert.Nil(t, EditPatch(fname, fname, c))
+	dp, err := ReadDrumPatch(fname)
+	assert.Nil(t, err)
+	assert.Equal(t, "cwo", dp.FxType)
+	assert.True(t, dp.FxActive)
+	assert.Equal(t, int64(1.7*44100)*SAMPLECONVERSION, dp.End[4])
+	assert.Equal(t, ReverseOn, dp.Reverse[4])
+	assert.Equal(t, "boombap1", dp.Name)
+
+	// the audio is kept
+	before, _ := aiff.Decode(data)
+	after, _ := aiff.ReadFile(fname)
+	soundBefore, _ := before.SoundData()
+	soundAfter, _ := after.SoundData()
+	assert.True(t, bytes.Equal(soundBefore.Data, soundAfter.Data))
+
+	// invalid changes leave the file alone
+	for _, change := range []string{`{"octave": 9}`, `{"wobble": 1}`, `{"name": 1}`, `{"keys": ["25:reverse"]}`, `{"keys": ["1:end=30"]}`} {
+		c, err = ParseChanges([]byte(change))
+		assert.Nil(t, err)
+		assert.NotNil(t, EditPatch(fname, fname, c), change)
+	}
+	dp2, err := ReadDrumPatch(fname)
+	assert.Nil(t, err)
+	assert.Equal(t, dp, dp2)
+
+	// synth patches
+	synth := filepath.Join(dir, "synth.aif")
+	c = Changes{}
+	assert.Nil(t, c.Set("octave=1"))
+	assert.Nil(t, c.Set("name=bells"))
+	assert.Nil(t, EditPatch("reverse/engines/cluster0.aif", synth, c))
+	sp, err := ReadSynthPatch(synth)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, sp.Octave)
+	assert.Equal(t, "bells", sp.Name)
+	assert.Equal(t, "cluster", sp.Type)
+	c.Keys = []string{"1:reverse"}
+	assert.NotNil(t, EditPatch(synth, synth, c))
+}
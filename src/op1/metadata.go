@@ -0,0 +1,89 @@
+package op1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/schollz/teoperator/src/aiff"
+)
+
+// setMetadata writes the patch as JSON into the op-1 APPL chunk,
+// padding it so that the FORM size is a multiple of align
+func setMetadata(f *aiff.File, patch interface{}, align int) (err error) {
+	op1dataBytes, err := json.Marshal(patch)
+	if err != nil {
+		return
+	}
+
+	// filler is to pad the aif file, the op-1 itself ends with a newline
+	// and never writes an odd sized chunk
+	filler := []byte{10}
+	for {
+		data := append(append([]byte{}, op1dataBytes...), filler...)
+		f.SetApplication("op-1", data)
+		if len(data)%2 == 0 && f.Size()%align == 0 {
+			break
+		}
+		filler = append(filler, 30)
+	}
+	return
+}
+
+// readMetadata decodes the JSON of the op-1 APPL chunk into patch,
+// returning the patch type
+func readMetadata(fname string, patch interface{}) (patchType string, err error) {
+	f, err := aiff.ReadFile(fname)
+	if err != nil {
+		return
+	}
+	data, ok := f.Application("op-1")
+	if !ok {
+		err = fmt.Errorf("could not find op-1 metadata in '%s'", fname)
+		return
+	}
+
+	// only decode the first JSON value, which ignores the filler
+	var header struct {
+		Type string `json:"type"`
+	}
+	err = json.NewDecoder(bytes.NewReader(data)).Decode(&header)
+	if err != nil {
+		err = fmt.Errorf("could not parse op-1 metadata in '%s': %s", fname, err.Error())
+		return
+	}
+	patchType = header.Type
+	if patch != nil {
+		err = json.NewDecoder(bytes.NewReader(data)).Decode(patch)
+	}
+	return
+}
+
+// IsPatch returns whether a file is an aif with op-1 metadata
+func IsPatch(fname string) bool {
+	f, err := aiff.ReadFile(fname)
+	if err != nil {
+		return false
+	}
+	_, ok := f.Application("op-1")
+	return ok
+}
+
+// ReadPatch reads the op-1 metadata of a patch. The patch is a DrumPatch
+// for drum kits and a SynthPatch for sampler and synth engine patches.
+// Patches of any other type are an error.
+func ReadPatch(fname string) (patch interface{}, err error) {
+	patchType, err := readMetadata(fname, nil)
+	if err != nil {
+		return
+	}
+	switch {
+	case patchType == "drum":
+		patch, err = ReadDrumPatch(fname)
+	case patchType == "sampler" || hasSetting(AllowedEngine, patchType):
+		patch, err = ReadSynthPatch(fname)
+	default:
+		err = fmt.Errorf("'%s' has an unknown patch type '%s'", fname, patchType)
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package op1
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Morph returns k patches between two patches of the same engine, not
+// including them. Engine, adsr, fx and lfo parameters are interpolated and
+// snapped to their nearest allowed value. Effects and lfos of different
+// types, and parameters that are choices, switch from a to b halfway.
+func Morph(a SynthPatch, b SynthPatch, k int) (patches []SynthPatch, err error) {
+	if a.Type != b.Type {
+		err = fmt.Errorf("cannot morph %s into %s, the engines need to be the same", a.Type, b.Type)
+		return
+	}
+	if a.Type == "drum" {
+		err = fmt.Errorf("cannot morph drum patches")
+		return
+	}
+	for i, patch := range []SynthPatch{a, b} {
+		if err = patch.Check(); err != nil {
+			err = fmt.Errorf("patch %d: %s", i+1, err.Error())
+			return
+		}
+	}
+	if k < 1 {
+		err = fmt.Errorf("need at least 1 patch between, not %d", k)
+		return
+	}
+	for i := 1; i <= k; i++ {
+		t := float64(i) / float64(k+1)
+		patch := a
+		if t >= 0.5 {
+			patch = b
+		}
+		interpolate(patch.Adsr[:], a.Adsr[:], b.Adsr[:], AllowedADSR, t)
+		interpolate(patch.Knobs[:], a.Knobs[:], b.Knobs[:], allowedParameters(AllowedEngine, a.Type), t)
+		if a.FxType == b.FxType {
+			interpolate(patch.FxParams[:], a.FxParams[:], b.FxParams[:], allowedParameters(AllowedEffects, a.FxType), t)
+		}
+		if a.LfoType == b.LfoType {
+			interpolate(patch.LfoParams[:], a.LfoParams[:], b.LfoParams[:], allowedParameters(AllowedLFO, a.LfoType), t)
+		}
+		patch.Octave = int(math.Round(float64(a.Octave) + t*float64(b.Octave-a.Octave)))
+		patch.Name = strings.Split(patch.Encode(), "-")[0]
+		patches = append(patches, patch)
+	}
+	return
+}
+
+// interpolate sets values to the allowed values between a and b at t from
+// 0 to 1
+func interpolate(values []int, a []int, b []int, allowed [][]int, t float64) {
+	for i := range values {
+		var choices []int
+		if i < len(allowed) {
+			choices = allowed[i]
+		}
+		if len(choices) > 0 && len(choices) < categorical {
+			// values is already a or b
+			continue
+		}
+		values[i] = int(math.Round(float64(a[i]) + t*float64(b[i]-a[i])))
+		if len(choices) > 0 {
+			values[i] = choices[nearestIndex(values[i], choices)]
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package op1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMorph(t *testing.T) {
+	a, err := ReadSynthPatch("reverse/engines/dna_min.aif")
+	assert.Nil(t, err)
+	b, err := ReadSynthPatch("reverse/engines/dna_max.aif")
+	assert.Nil(t, err)
+
+	patches, err := Morph(a, b, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(patches))
+	allowed := allowedParameters(AllowedEngine, "dna")
+	for i, patch := range patches {
+		assert.Nil(t, patch.Check())
+		for j := range allowed {
+			assert.True(t, Has(allowed[j], patch.Knobs[j]))
+			// every step moves from a towards b
+			previous := a.Knobs[j]
+			if i > 0 {
+				previous = patches[i-1].Knobs[j]
+			}
+			if a.Knobs[j] < b.Knobs[j] {
+				assert.True(t, patch.Knobs[j] >= previous)
+			} else {
+				assert.True(t, patch.Knobs[j] <= previous)
+			}
+		}
+	}
+
+	c, err := ReadSynthPatch("reverse/engines/cluster0.aif")
+	assert.Nil(t, err)
+	_, err = Morph(a, c, 3)
+	assert.NotNil(t, err)
+	_, err = Morph(a, b, 0)
+	assert.NotNil(t, err)
+}
+
+func TestInterpolate(t *testing.T) {
+	values := []int{0, 0, 5}
+	interpolate(values, []int{0, 0, 5}, []int{100, 10, 9}, [][]int{Range(0, 100, 10), {0, 10}}, 0.26)
+	// snapped, choices kept and without allowed values rounded
+	assert.Equal(t, []int{26, 0, 6}, values)
+}
@@ -4,8 +4,12 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"testing"
 
+	"github.com/schollz/teoperator/src/aiff"
+	"github.com/schollz/teoperator/src/audio"
+	"github.com/schollz/teoperator/src/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -31,6 +35,152 @@ func TestDrumPatch(t *testing.T) {
 	assert.Nil(t, dp.Save("tests/1.aif", "drum.aif"))
 }
 
+func TestDrumPatchNormalize(t *testing.T) {
+	// a loud hit on the first key and a quiet one on the second
+	b := &audio.Buffer{SampleRate: 44100, Channels: 1, Samples: make([]float64, 2000)}
+	b.Samples[10] = 0.5
+	b.Samples[1010] = 0.05
+	dp := NewDrumPatch()
+	dp.Start[0], dp.End[0] = 0, 1000*OP1.SampleConversion
+	dp.Start[1], dp.End[1] = 1000*OP1.SampleConversion, 2000*OP1.SampleConversion
+
+	dp.Normalization = audio.Normalization{Mode: audio.Peak, Target: 0}
+	whole := b.Copy()
+	dp.Normalize(whole, []int{0, 1})
+	assert.InDelta(t, 1, whole.Samples[10], 1e-9)
+	assert.InDelta(t, 0.1, whole.Samples[1010], 1e-9)
+
+	dp.Normalization.PerSlice = true
+	dp.Normalize(b, []int{0, 1})
+	assert.InDelta(t, 1, b.Samples[10], 1e-9)
+	assert.InDelta(t, 1, b.Samples[1010], 1e-9)
+
+	// a single long hit is leveled as one, even though the default
+	// positions of the other keys cut through it
+	b = &audio.Buffer{SampleRate: 44100, Channels: 1, Samples: make([]float64, 30000)}
+	b.Samples[10] = 0.5
+	b.Samples[25000] = 0.05
+	dp = NewDrumPatch()
+	dp.Start[0], dp.End[0] = 0, 30000*OP1.SampleConversion
+	assert.True(t, dp.Start[1] < dp.End[0])
+	dp.Normalization = audio.Normalization{Mode: audio.Peak, Target: 0, PerSlice: true}
+	dp.Normalize(b, []int{0})
+	assert.InDelta(t, 1, b.Samples[10], 1e-9)
+	assert.InDelta(t, 0.1, b.Samples[25000], 1e-9)
+}
+
+func TestDrumPatchCheck(t *testing.T) {
+	dp := NewDrumPatch()
+	assert.Nil(t, dp.Check())
+	dp, err := ReadDrumPatch("tests/1.aif")
+	assert.Nil(t, err)
+	assert.Nil(t, dp.Check())
+
+	dp.Start[2] = dp.End[2] + 1
+	dp.Reverse[4] = 1
+	dp.FxType = "wobble"
+	err = dp.Check()
+	assert.NotNil(t, err)
+	violations, ok := err.(Violations)
+	assert.True(t, ok)
+	assert.Equal(t, Violations{
+		{Key: 0, Field: "fx_type", Message: "'wobble' is unknown"},
+		{Key: 3, Field: "start", Message: "211907778 is after end 211907777"},
+		{Key: 5, Field: "reverse", Message: "1 is unknown"},
+	}, violations)
+
+	dp = NewDrumPatch()
+	dp.Volume = dp.Volume[:12]
+	err = dp.Check()
+	assert.Equal(t, "invalid drum patch: volume: has 12 entries, needs 24", err.Error())
+
+	// saving fails before any audio is converted
+	assert.NotNil(t, dp.Save("tests/1.aif", "drum.aif"))
+
+	// positions past the end are reported, not changed
+	dp = NewDrumPatch()
+	dp.End[23] = MAXENDPOINT + 1
+	err = dp.SaveBuffer(&audio.Buffer{SampleRate: 44100, Channels: 1, Samples: make([]float64, 44100)}, "drum.aif")
+	assert.Equal(t, "invalid drum patch: key 24 end: 2147483647 is out of range", err.Error())
+	assert.Equal(t, MAXENDPOINT+1, dp.End[23])
+	for _, d := range Devices {
+		assert.True(t, d.MaxDrumSamples()*d.SampleConversion <= MAXENDPOINT, d.Name)
+	}
+	// the op-1 field fits all of its 20 seconds
+	assert.Equal(t, int64(20*44100), OP1Field.MaxDrumSamples())
+}
+
+func TestSetMetadata(t *testing.T) {
+	// the op-1 drum patch already has an APPL chunk that must be replaced
+	f, err := aiff.ReadFile("tests/1.aif")
+	assert.Nil(t, err)
+	sound, err := f.SoundData()
+	assert.Nil(t, err)
+	dp := NewDrumPatch()
+	dp.Name = "replaced"
+	assert.Nil(t, setMetadata(&f, dp, 4))
+
+	f, err = aiff.Decode(f.Encode())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, f.Size()%4)
+	numAppl := 0
+	for _, c := range f.Chunks {
+		if c.ID == "APPL" {
+			numAppl++
+		}
+	}
+	assert.Equal(t, 1, numAppl)
+	data, ok := f.Application("op-1")
+	assert.True(t, ok)
+	assert.Contains(t, string(data), `"name":"replaced"`)
+	sound2, err := f.SoundData()
+	assert.Nil(t, err)
+	assert.Equal(t, sound.Data, sound2.Data)
+}
+
+func TestReadDrumPatch(t *testing.T) {
+	dp, err := ReadDrumPatch("tests/1.aif")
+	assert.Nil(t, err)
+	assert.Equal(t, "boombap1", dp.Name)
+	assert.Equal(t, 24, len(dp.Start))
+	assert.Equal(t, int64(97643143), dp.End[0])
+
+	_, err = ReadDrumPatch("reverse/engines/cluster0.aif")
+	assert.NotNil(t, err)
+	_, err = ReadSynthPatch("tests/1.aif")
+	assert.NotNil(t, err)
+}
+
+func TestReadPatch(t *testing.T) {
+	patch, err := ReadPatch("tests/1.aif")
+	assert.Nil(t, err)
+	assert.IsType(t, DrumPatch{}, patch)
+
+	patch, err = ReadPatch("reverse/engines/cluster0.aif")
+	assert.Nil(t, err)
+	assert.IsType(t, SynthPatch{}, patch)
+	assert.Equal(t, "cluster", patch.(SynthPatch).Type)
+
+	// nested braces in the JSON should not end the metadata
+	sp := NewSynthSamplePatch(220)
+	sp.Name = "{ab}"
+	fname := utils.TempFileName("sampler", ".aif")
+	defer os.Remove(fname)
+	assert.Nil(t, sp.SaveSynth(fname))
+	patch, err = ReadPatch(fname)
+	assert.Nil(t, err)
+	assert.Equal(t, sp, patch)
+
+	// unknown types are not taken for synth patches
+	sp.Type = "organ"
+	f, err := aiff.Decode(defaultSynthAif)
+	assert.Nil(t, err)
+	assert.Nil(t, setMetadata(&f, sp, 2))
+	assert.Nil(t, f.WriteFile(fname))
+	_, err = ReadPatch(fname)
+	assert.Equal(t, fmt.Sprintf("'%s' has an unknown patch type 'organ'", fname), err.Error())
+}
+
 func TestReadSynth(t *testing.T) {
 	sp, err := ReadSynthPatch("reverse/lfo/tremelo/minspeed_-100_-100_minslope_env0.aif")
 	assert.Nil(t, err)
@@ -99,3 +249,37 @@ func TestReadSynth(t *testing.T) {
 	// fmt.Println(sp)
 	// fmt.Println(AllowedAttack)
 }
+
+func TestGetDevice(t *testing.T) {
+	for _, name := range []string{"", "op-1", "OP1", "op_1"} {
+		d, err := GetDevice(name)
+		assert.Nil(t, err)
+		assert.Equal(t, OP1, d)
+	}
+	d, err := GetDevice("opz")
+	assert.Nil(t, err)
+	assert.Equal(t, OPZ, d)
+	d, err = GetDevice("OP-1 Field")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, d.Channels)
+	_, err = GetDevice("op-2")
+	assert.NotNil(t, err)
+	assert.Equal(t, "op-1/op-z", DrumDeviceNames(2))
+	assert.Equal(t, "op-1-field", DrumDeviceNames(3))
+	assert.Equal(t, "unknown device", DrumDeviceNames(7))
+
+	dp := NewDrumPatch()
+	dp.SetDevice(OPZ)
+	assert.Equal(t, OPZ.DrumVersion, dp.DrumVersion)
+	assert.Nil(t, dp.Check())
+
+	dp.SetDevice(OP1Field)
+	assert.Equal(t, 3, dp.DrumVersion)
+	sp := NewSynthSamplePatch()
+	sp.SetDevice(OP1Field)
+	assert.Equal(t, 3, sp.SynthVersion)
+	// synth engine patches keep their version
+	sp = NewSynthPatch()
+	sp.SetDevice(OP1Field)
+	assert.Equal(t, 2, sp.SynthVersion)
+}
@@ -0,0 +1,158 @@
+package op1
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Constraints limit the values of random synth patches. Empty lists allow
+// every setting.
+type Constraints struct {
+	// Engines, Effects and LFOs are names of AllowedEngine, AllowedEffects
+	// and AllowedLFO
+	Engines []string
+	Effects []string
+	LFOs    []string
+	// ADSR limits the attack, decay, sustain and release, nil allows every
+	// value
+	ADSR [4]*Bounds
+}
+
+// Bounds are the lowest and highest value of a parameter, inclusive
+type Bounds struct {
+	Min int
+	Max int
+}
+
+// ParseBounds parses bounds like "64:4000"
+func ParseBounds(s string) (b Bounds, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) == 2 {
+		b.Min, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err == nil {
+			b.Max, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		}
+	}
+	if len(parts) != 2 || err != nil || b.Min > b.Max {
+		err = fmt.Errorf("bounds '%s' should look like 'min:max'", s)
+	}
+	return
+}
+
+// filter returns the values within the bounds, or all values without bounds
+func (b *Bounds) filter(values []int) (filtered []int) {
+	if b == nil {
+		return values
+	}
+	for _, v := range values {
+		if v >= b.Min && v <= b.Max {
+			filtered = append(filtered, v)
+		}
+	}
+	return
+}
+
+// RandomSynthPatch returns a random synth engine patch, which is the same
+// for the same seed
+func RandomSynthPatch(seed ...int64) (sd SynthPatch) {
+	s := time.Now().UnixNano()
+	if len(seed) > 0 {
+		s = seed[0]
+	}
+	patches, _ := RandomSynthPatches(1, s, Constraints{})
+	return patches[0]
+}
+
+// RandomSynthPatches returns n random synth engine patches within the
+// constraints. The same seed and constraints return the same patches.
+func RandomSynthPatches(n int, seed int64, c Constraints) (patches []SynthPatch, err error) {
+	if n < 1 {
+		err = fmt.Errorf("need at least 1 patch, not %d", n)
+		return
+	}
+	engines, err := chooseSettings(AllowedEngine, c.Engines, "engine")
+	if err != nil {
+		return
+	}
+	effects, err := chooseSettings(AllowedEffects, c.Effects, "effect")
+	if err != nil {
+		return
+	}
+	lfos, err := chooseSettings(AllowedLFO, c.LFOs, "lfo")
+	if err != nil {
+		return
+	}
+	adsr := make([][]int, len(AllowedADSR))
+	for i := range adsr {
+		adsr[i] = AllowedADSR[i]
+		if i < len(c.ADSR) {
+			adsr[i] = c.ADSR[i].filter(adsr[i])
+		}
+		if len(adsr[i]) == 0 {
+			err = fmt.Errorf("no allowed values for adsr %d within %d:%d", i, c.ADSR[i].Min, c.ADSR[i].Max)
+			return
+		}
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	pick := func(values []int) int {
+		return values[r.Intn(len(values))]
+	}
+	patches = make([]SynthPatch, n)
+	for j := range patches {
+		sd := NewSynthPatch()
+		for i := range adsr {
+			sd.Adsr[i] = pick(adsr[i])
+		}
+
+		setting := engines[r.Intn(len(engines))]
+		sd.Type = setting.Name
+		for i := range setting.Parameters {
+			sd.Knobs[i] = pick(setting.Parameters[i])
+		}
+
+		setting = effects[r.Intn(len(effects))]
+		sd.FxType = setting.Name
+		for i := range setting.Parameters {
+			sd.FxParams[i] = pick(setting.Parameters[i])
+		}
+		sd.FxActive = true
+
+		setting = lfos[r.Intn(len(lfos))]
+		sd.LfoType = setting.Name
+		for i := range setting.Parameters {
+			sd.LfoParams[i] = pick(setting.Parameters[i])
+		}
+		sd.LfoActive = true
+
+		sd.Name = strings.Split(sd.Encode(), "-")[0]
+		patches[j] = sd
+	}
+	return
+}
+
+// chooseSettings returns the measured settings with the given names, or all
+// of them
+func chooseSettings(settings []Setting, names []string, kind string) (chosen []Setting, err error) {
+	var known []string
+	for _, setting := range settings {
+		if setting.Parameters != nil {
+			known = append(known, setting.Name)
+		}
+	}
+	for _, name := range names {
+		if !hasString(known, name) {
+			err = fmt.Errorf("unknown %s '%s', use one of %s", kind, name, strings.Join(known, ", "))
+			return
+		}
+	}
+	for _, setting := range settings {
+		if hasString(known, setting.Name) && (len(names) == 0 || hasString(names, setting.Name)) {
+			chosen = append(chosen, setting)
+		}
+	}
+	return
+}
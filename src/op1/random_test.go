@@ -0,0 +1,68 @@
+package op1
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomSynthPatches(t *testing.T) {
+	patches, err := RandomSynthPatches(20, 42, Constraints{})
+	assert.Nil(t, err)
+	assert.Len(t, patches, 20)
+	again, err := RandomSynthPatches(20, 42, Constraints{})
+	assert.Nil(t, err)
+	assert.Equal(t, patches, again)
+	other, err := RandomSynthPatches(20, 43, Constraints{})
+	assert.Nil(t, err)
+	assert.NotEqual(t, patches, other)
+	assert.Equal(t, RandomSynthPatch(42), patches[0])
+
+	c := Constraints{Engines: []string{"dna", "cluster"}, Effects: []string{"delay"}, LFOs: []string{"element"}}
+	c.ADSR[Attack] = &Bounds{64, 1000}
+	c.ADSR[Sustain] = &Bounds{32000, 32767}
+	patches, err = RandomSynthPatches(20, 1, c)
+	assert.Nil(t, err)
+	dir, err := ioutil.TempDir("", "random")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, sp := range patches {
+		assert.Contains(t, c.Engines, sp.Type)
+		assert.Equal(t, "delay", sp.FxType)
+		assert.Equal(t, "element", sp.LfoType)
+		assert.True(t, sp.Adsr[Attack] <= 1000)
+		assert.True(t, sp.Adsr[Sustain] >= 32000)
+		assert.Nil(t, sp.SaveSynth(filepath.Join(dir, sp.Encode()+".aif")))
+	}
+
+	_, err = RandomSynthPatches(1, 1, Constraints{Engines: []string{"organ"}})
+	assert.NotNil(t, err)
+	c = Constraints{}
+	c.ADSR[Decay] = &Bounds{1, 2}
+	_, err = RandomSynthPatches(1, 1, c)
+	assert.NotNil(t, err)
+	_, err = RandomSynthPatches(-1, 1, Constraints{})
+	assert.NotNil(t, err)
+
+	// bounds of zero are not the same as no bounds
+	c = Constraints{}
+	c.ADSR[Sustain] = &Bounds{0, 0}
+	patches, err = RandomSynthPatches(20, 1, c)
+	assert.Nil(t, err)
+	for _, sp := range patches {
+		assert.Equal(t, 0, sp.Adsr[Sustain])
+	}
+}
+
+func TestParseBounds(t *testing.T) {
+	b, err := ParseBounds("64:4000")
+	assert.Nil(t, err)
+	assert.Equal(t, Bounds{64, 4000}, b)
+	for _, s := range []string{"64", "a:4", "5:4", "1:2:3"} {
+		_, err = ParseBounds(s)
+		assert.NotNil(t, err, s)
+	}
+}
@@ -0,0 +1,333 @@
+package op1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parameter describes how a raw value of a patch shows on the op-1 screen
+type Parameter struct {
+	// Name of the parameter, parameters without a name are not shown
+	Name string
+	// Min and Max are the raw values shown as Low and High
+	Min  int
+	Max  int
+	Low  int
+	High int
+	// Choices name the raw values of parameters that are a choice
+	Choices []Choice
+}
+
+// Choice is a named raw value
+type Choice struct {
+	Name  string
+	Value int
+}
+
+// knobColors name the knobs of engines and effects after the encoders of
+// the op-1
+var knobColors = []string{"blue", "green", "white", "red"}
+
+// EnvelopeParameters describe the adsr values of a synth patch
+var EnvelopeParameters = []Parameter{
+	{Name: "attack", Min: 64, Max: 16320, High: 99},
+	{Name: "decay", Min: 64, Max: 16320, High: 99},
+	{Name: "sustain", Min: 0, Max: 32767, High: 99},
+	{Name: "release", Min: 64, Max: 16320, High: 99},
+	{Name: "playmode", Choices: []Choice{{"poly", 2048}, {"mono", 5120}, {"legato", 11264}, {"unison", 14336}}},
+	{Name: "portamento", Min: 64, Max: 16320, High: 127},
+}
+
+// lfoParameters describe lfos that do not have four knobs from 0 to 99
+var lfoParameters = map[string][]Parameter{
+	"element": {
+		{Name: "source", Choices: []Choice{{"sum", 7168}, {"adsr", 5280}, {"g", 2000}, {"mic", 2144}}},
+		{Name: "amount", Min: -32767, Max: 32767, Low: -100, High: 100},
+		{Name: "destination", Choices: []Choice{{"wave", 1024}, {"adsr", 2448}, {"fx", 5056}, {"sound", 7168}}},
+		{Name: "parameter", Choices: []Choice{{"blue", 1024}, {"green", 5824}, {"white", 10624}, {"red", 15360}}},
+	},
+	"tremolo": {
+		{Name: "speed", Min: 16400, Max: 32440, High: 99},
+		{Name: "pitch", Min: -32767, Max: 32767, Low: -100, High: 100},
+		{Name: "volume", Min: -32767, Max: 32767, Low: -100, High: 100},
+		{Name: "slope", Min: 0, Max: 32767, High: 99},
+		{}, {}, {},
+		{Name: "envelope", Choices: []Choice{{"off", 0}, {"on", 9216}}},
+	},
+}
+
+// EngineParameters describe the knobs of a measured engine
+func EngineParameters(engine string) ([]Parameter, error) {
+	return describe(AllowedEngine, engine, nil)
+}
+
+// EffectParameters describe the parameters of a measured effect
+func EffectParameters(fx string) ([]Parameter, error) {
+	return describe(AllowedEffects, fx, nil)
+}
+
+// LFOParameters describe the parameters of a measured lfo
+func LFOParameters(lfo string) ([]Parameter, error) {
+	return describe(AllowedLFO, lfo, lfoParameters)
+}
+
+// describe returns the described parameters of the setting, or knobs from
+// 0 to 99 for its allowed values. Parameters with one allowed value are not
+// shown.
+func describe(settings []Setting, name string, described map[string][]Parameter) (params []Parameter, err error) {
+	allowed := allowedParameters(settings, name)
+	if allowed == nil {
+		err = fmt.Errorf("the parameters of %s are not measured", name)
+		return
+	}
+	if described[name] != nil {
+		params = described[name]
+		return
+	}
+	for i, values := range allowed {
+		p := Parameter{Min: values[0], Max: values[len(values)-1], High: 99}
+		if len(values) > 1 && i < len(knobColors) {
+			p.Name = knobColors[i]
+		}
+		params = append(params, p)
+	}
+	return
+}
+
+// Show returns the raw value as it shows on the screen, which is the name
+// of a choice or a number. Choices without a name are the raw value.
+func (p Parameter) Show(raw int) interface{} {
+	if len(p.Choices) > 0 {
+		for _, choice := range p.Choices {
+			if choice.Value == raw {
+				return choice.Name
+			}
+		}
+		return raw
+	}
+	if p.Max == p.Min {
+		return p.Low
+	}
+	value := float64(p.Low) + float64(raw-p.Min)*float64(p.High-p.Low)/float64(p.Max-p.Min)
+	return int(math.Max(float64(p.Low), math.Min(float64(p.High), math.Round(value))))
+}
+
+// Raw returns the raw value of a name of a choice or a number on the screen
+func (p Parameter) Raw(value interface{}) (raw int, err error) {
+	s := strings.TrimSpace(fmt.Sprint(value))
+	if len(p.Choices) > 0 {
+		var names []string
+		for _, choice := range p.Choices {
+			if strings.EqualFold(choice.Name, s) {
+				raw = choice.Value
+				return
+			}
+			names = append(names, choice.Name)
+		}
+		// unnamed choices are kept as raw values
+		raw, err = strconv.Atoi(s)
+		if err != nil {
+			err = fmt.Errorf("%s '%s' should be one of %s", p.Name, s, strings.Join(names, ", "))
+		}
+		return
+	}
+	number, err := strconv.ParseFloat(s, 64)
+	if err != nil || number < float64(p.Low) || number > float64(p.High) {
+		err = fmt.Errorf("%s '%s' should be a number from %d to %d", p.Name, s, p.Low, p.High)
+		return
+	}
+	if p.High == p.Low {
+		raw = p.Min
+		return
+	}
+	raw = int(math.Round(float64(p.Min) + (number-float64(p.Low))*float64(p.Max-p.Min)/float64(p.High-p.Low)))
+	return
+}
+
+// ReadablePatch is a synth patch with the values shown on the op-1 screen,
+// to write patches by hand. Engines, effects and lfos that are not measured
+// keep the values stored in the patch as raw values.
+type ReadablePatch struct {
+	Name     string                 `json:"name" yaml:"name"`
+	Engine   string                 `json:"engine" yaml:"engine"`
+	Octave   int                    `json:"octave" yaml:"octave"`
+	BaseFreq float64                `json:"base_freq,omitempty" yaml:"base_freq,omitempty"`
+	Knobs    map[string]interface{} `json:"knobs,omitempty" yaml:"knobs,omitempty"`
+	RawKnobs []int                  `json:"raw_knobs,omitempty" yaml:"raw_knobs,omitempty,flow"`
+	Envelope map[string]interface{} `json:"envelope" yaml:"envelope"`
+	Fx       ReadableModule         `json:"fx" yaml:"fx"`
+	Lfo      ReadableModule         `json:"lfo" yaml:"lfo"`
+}
+
+// ReadableModule is the effect or lfo of a ReadablePatch
+type ReadableModule struct {
+	Type       string                 `json:"type" yaml:"type"`
+	Active     bool                   `json:"active" yaml:"active"`
+	Parameters map[string]interface{} `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Raw        []int                  `json:"raw,omitempty" yaml:"raw,omitempty,flow"`
+}
+
+// Readable returns the patch with the values shown on the op-1 screen
+func (s SynthPatch) Readable() (r ReadablePatch) {
+	r = ReadablePatch{
+		Name:     s.Name,
+		Engine:   s.Type,
+		Octave:   s.Octave,
+		BaseFreq: s.BaseFreq,
+		Envelope: show(EnvelopeParameters, s.Adsr[:]),
+		Fx:       ReadableModule{Type: s.FxType, Active: s.FxActive},
+		Lfo:      ReadableModule{Type: s.LfoType, Active: s.LfoActive},
+	}
+	if params, err := EngineParameters(s.Type); err == nil {
+		r.Knobs = show(params, s.Knobs[:])
+	} else {
+		r.RawKnobs = append([]int{}, s.Knobs[:]...)
+	}
+	if params, err := EffectParameters(s.FxType); err == nil {
+		r.Fx.Parameters = show(params, s.FxParams[:])
+	} else {
+		r.Fx.Raw = append([]int{}, s.FxParams[:]...)
+	}
+	if params, err := LFOParameters(s.LfoType); err == nil {
+		r.Lfo.Parameters = show(params, s.LfoParams[:])
+	} else {
+		r.Lfo.Raw = append([]int{}, s.LfoParams[:]...)
+	}
+	return
+}
+
+// SynthPatch returns the patch with raw values, snapped to the nearest
+// allowed value. Values that are not given are kept from the default
+// cluster patch, or the default sampler patch for the sampler.
+func (r ReadablePatch) SynthPatch() (s SynthPatch, err error) {
+	s = NewSynthPatch()
+	if r.Engine == "sampler" {
+		s = NewSynthSamplePatch()
+	}
+	if r.Engine != "" {
+		s.Type = r.Engine
+	}
+	if r.Name != "" {
+		s.Name = r.Name
+	}
+	if r.BaseFreq > 0 {
+		s.BaseFreq = r.BaseFreq
+	}
+	s.Octave = r.Octave
+	if r.Fx.Type != "" {
+		s.FxType = r.Fx.Type
+	}
+	s.FxActive = r.Fx.Active
+	if r.Lfo.Type != "" {
+		s.LfoType = r.Lfo.Type
+	}
+	s.LfoActive = r.Lfo.Active
+
+	if err = raw(s.Knobs[:], r.RawKnobs, r.Knobs, allowedParameters(AllowedEngine, s.Type), func() ([]Parameter, error) {
+		return EngineParameters(s.Type)
+	}); err != nil {
+		return
+	}
+	if err = raw(s.FxParams[:], r.Fx.Raw, r.Fx.Parameters, allowedParameters(AllowedEffects, s.FxType), func() ([]Parameter, error) {
+		return EffectParameters(s.FxType)
+	}); err != nil {
+		return
+	}
+	if err = raw(s.LfoParams[:], r.Lfo.Raw, r.Lfo.Parameters, allowedParameters(AllowedLFO, s.LfoType), func() ([]Parameter, error) {
+		return LFOParameters(s.LfoType)
+	}); err != nil {
+		return
+	}
+	if err = raw(s.Adsr[:], nil, r.Envelope, AllowedADSR, func() ([]Parameter, error) {
+		return EnvelopeParameters, nil
+	}); err != nil {
+		return
+	}
+	err = s.Check()
+	return
+}
+
+// show returns the named parameters of the raw values
+func show(params []Parameter, values []int) map[string]interface{} {
+	shown := make(map[string]interface{})
+	for i, p := range params {
+		if p.Name != "" && i < len(values) {
+			shown[p.Name] = p.Show(values[i])
+		}
+	}
+	if len(shown) == 0 {
+		return nil
+	}
+	return shown
+}
+
+// raw sets the raw values and the values of the named parameters of the
+// setting, and snaps every value to the nearest allowed value
+func raw(values []int, raws []int, shown map[string]interface{}, allowed [][]int, parameters func() ([]Parameter, error)) (err error) {
+	if len(raws) > len(values) {
+		err = fmt.Errorf("there are %d raw values, not %d", len(values), len(raws))
+		return
+	}
+	copy(values, raws)
+	var params []Parameter
+	if len(shown) > 0 {
+		params, err = parameters()
+		if err != nil {
+			return
+		}
+	}
+	var names []string
+	for _, p := range params {
+		if p.Name != "" {
+			names = append(names, p.Name)
+		}
+	}
+	for name, value := range shown {
+		if !hasString(names, name) {
+			err = fmt.Errorf("unknown parameter '%s', use one of %s", name, strings.Join(names, ", "))
+			return
+		}
+		for i, p := range params {
+			if p.Name == name {
+				values[i], err = p.Raw(value)
+				if err != nil {
+					return
+				}
+			}
+		}
+	}
+	for i := range allowed {
+		if i < len(values) && len(allowed[i]) > 0 {
+			values[i] = allowed[i][nearestIndex(values[i], allowed[i])]
+		}
+	}
+	return
+}
+
+// ParseReadablePatch reads a json or yaml ReadablePatch
+func ParseReadablePatch(data []byte) (r ReadablePatch, err error) {
+	// json is yaml
+	err = yaml.Unmarshal(data, &r)
+	if err != nil {
+		err = fmt.Errorf("could not parse patch: %s", err.Error())
+	}
+	return
+}
+
+// ReadReadablePatch reads a json or yaml ReadablePatch from a file
+func ReadReadablePatch(fname string) (r ReadablePatch, err error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return
+	}
+	r, err = ParseReadablePatch(data)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", fname, err.Error())
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package op1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParameter(t *testing.T) {
+	portamento := EnvelopeParameters[Portamendo]
+	assert.Equal(t, 0, portamento.Show(64))
+	assert.Equal(t, 1, portamento.Show(192))
+	assert.Equal(t, 127, portamento.Show(16320))
+	raw, err := portamento.Raw(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 192, raw)
+	_, err = portamento.Raw(128)
+	assert.NotNil(t, err)
+
+	playmode := EnvelopeParameters[Playmode]
+	assert.Equal(t, "legato", playmode.Show(11264))
+	raw, err = playmode.Raw("Mono")
+	assert.Nil(t, err)
+	assert.Equal(t, 5120, raw)
+	_, err = playmode.Raw("stereo")
+	assert.NotNil(t, err)
+
+	params, err := LFOParameters("element")
+	assert.Nil(t, err)
+	assert.Equal(t, -100, params[1].Show(-32767))
+	assert.Equal(t, 0, params[1].Show(0))
+	assert.Equal(t, "red", params[3].Show(15360))
+	params, err = EngineParameters("dna")
+	assert.Nil(t, err)
+	assert.Equal(t, "blue", params[0].Name)
+	assert.Equal(t, 99, params[0].Show(32767))
+	params, err = EngineParameters("drwave")
+	assert.Nil(t, err)
+	assert.Equal(t, "red", params[3].Name)
+	assert.Equal(t, "", params[4].Name)
+
+	// parameters that are not measured are not described
+	_, err = EngineParameters("fm")
+	assert.NotNil(t, err)
+	_, err = EffectParameters("spring")
+	assert.NotNil(t, err)
+	_, err = LFOParameters("value")
+	assert.NotNil(t, err)
+}
+
+func TestReadablePatch(t *testing.T) {
+	sp, err := ReadSynthPatch("reverse/lfo/tremelo/maxspeed_100_100_maxslope_env1.aif")
+	assert.Nil(t, err)
+	r := sp.Readable()
+	assert.Equal(t, map[string]interface{}{"speed": 99, "pitch": 100, "volume": 100, "slope": 99, "envelope": "on"}, r.Lfo.Parameters)
+	assert.Equal(t, "unison", r.Envelope["playmode"])
+
+	// values stay the same when written and read again
+	data, err := yaml.Marshal(r)
+	assert.Nil(t, err)
+	r2, err := ParseReadablePatch(data)
+	assert.Nil(t, err)
+	sp2, err := r2.SynthPatch()
+	assert.Nil(t, err)
+	assert.Equal(t, r, sp2.Readable())
+	assert.Equal(t, sp.LfoParams, sp2.LfoParams)
+	assert.InDelta(t, sp.Knobs[0], sp2.Knobs[0], 32767/99)
+
+	r, err = ParseReadablePatch([]byte(`{"engine": "digital", "knobs": {"blue": 50}, "envelope": {"attack": 0, "playmode": "mono", "portamento": 1},
+		"fx": {"type": "cwo", "active": true}, "lfo": {"type": "element", "parameters": {"source": "mic", "destination": "sound"}}}`))
+	assert.Nil(t, err)
+	sp, err = r.SynthPatch()
+	assert.Nil(t, err)
+	assert.Equal(t, "digital", sp.Type)
+	assert.Equal(t, 16549, sp.Knobs[0])
+	assert.Equal(t, []int{64, 5120, 192}, []int{sp.Adsr[Attack], sp.Adsr[Playmode], sp.Adsr[Portamendo]})
+	assert.Equal(t, []int{2144, 7168}, []int{sp.LfoParams[0], sp.LfoParams[2]})
+
+	// engines that are not measured keep their raw values
+	sp, err = ReadSynthPatch("reverse/portamendo/portamendo1.aif")
+	assert.Nil(t, err)
+	r = sp.Readable()
+	assert.Nil(t, r.Knobs)
+	assert.Equal(t, sp.Knobs[:], r.RawKnobs)
+	assert.Equal(t, sp.LfoParams[:], r.Lfo.Raw)
+	sp2, err = r.SynthPatch()
+	assert.Nil(t, err)
+	assert.Equal(t, sp.Knobs, sp2.Knobs)
+	assert.Equal(t, sp.LfoParams, sp2.LfoParams)
+
+	for _, s := range []string{
+		`{"engine": "fm", "knobs": {"blue": 50}}`,
+		`{"lfo": {"type": "value", "parameters": {"blue": 50}}}`,
+		`{"engine": "organ"}`,
+		`{"envelope": {"attack": 100}}`,
+		`{"envelope": {"loudness": 1}}`,
+		`{"lfo": {"type": "tremolo", "parameters": {"envelope": "maybe"}}}`,
+	} {
+		r, err = ParseReadablePatch([]byte(s))
+		assert.Nil(t, err)
+		_, err = r.SynthPatch()
+		assert.NotNil(t, err, s)
+	}
+}
@@ -1,22 +1,17 @@
 package op1
 
 import (
-	"bytes"
 	"crypto/md5"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"math"
 	"math/rand"
-	"os"
-	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/schollz/logger"
-	"github.com/schollz/teoperator/src/ffmpeg"
-	"github.com/schollz/teoperator/src/models"
+	"github.com/schollz/teoperator/src/aiff"
+	"github.com/schollz/teoperator/src/audio"
 	"github.com/speps/go-hashids"
 )
 
@@ -68,6 +63,12 @@ type SynthPatch struct {
 	SynthVersion int     `json:"synth_version"`
 	Type         string  `json:"type"`
 	BaseFreq     float64 `json:"base_freq,omitempty"`
+
+	// Device is the target device, the op-1 if not set
+	Device Device `json:"-"`
+	// Normalization levels sampler patches, audio.DefaultNormalization
+	// if not set
+	Normalization audio.Normalization `json:"-"`
 }
 
 // ADSR parameters
@@ -85,7 +86,18 @@ type Setting struct {
 	Parameters [][]int
 }
 
-// specified allowed values for parameters
+// FxTypes and LfoTypes are the names of all effects and lfos of the op-1
+var (
+	FxTypes  = []string{"cwo", "delay", "grid", "nitro", "phone", "punch", "spring"}
+	LfoTypes = []string{"bend", "crank", "element", "midi", "random", "tremolo", "value"}
+)
+
+// specified allowed values for parameters, measured on the patches in
+// reverse/. The settings list every engine, effect and lfo of the op-1 by
+// name, but only cluster, digital, dna and drwave, nitro, cwo, delay and
+// grid, and element and tremolo have measured parameters. The others have
+// no parameters: Check only checks their names, and random, bred, morphed
+// and readable patches do not use them.
 var (
 	AllowedADSR = [][]int{
 		Range(64, 16320, 512),           // Attack
@@ -93,7 +105,7 @@ var (
 		Range(0, 32767, 512),            // Sustain
 		Range(64, 16320, 512),           // Release
 		[]int{2048, 5120, 11264, 14336}, // Playmode  (poly, mono, legato, unison)
-		[]int{64, 192, 6140},            // Portamendo 64 = off, 192 = 1, 6140 = 127 TODO: need more info
+		[]int{64, 192, 16320},           // Portamendo 64 = off, 192 = 1, 16320 = 127 TODO: measure the values in between
 	}
 
 	AllowedOctave = []int{-2, 1, 0, 1, 2} // Octave ranges from -2 to +2
@@ -117,6 +129,7 @@ var (
 				Range(0, 32767, 128),
 			},
 		},
+		Setting{Name: "dimension"},
 		Setting{
 			Name: "dna",
 			Parameters: [][]int{
@@ -136,6 +149,11 @@ var (
 				Range(32000, 32000, 128),
 			},
 		},
+		Setting{Name: "fm"},
+		Setting{Name: "phase"},
+		Setting{Name: "pulse"},
+		Setting{Name: "string"},
+		Setting{Name: "voltage"},
 	}
 
 	AllowedEffects = []Setting{
@@ -179,31 +197,39 @@ var (
 				Range(8000, 8000, 128),
 			},
 		},
+		Setting{Name: "phone"},
+		Setting{Name: "punch"},
+		Setting{Name: "spring"},
 	}
 
 	AllowedLFO = []Setting{
+		Setting{Name: "bend"},
+		Setting{Name: "crank"},
 		Setting{
 			Name: "element",
 			Parameters: [][]int{
-				[]int{7168, 5056, 5280, 2000, 2144},         // sum, adsr, g, mic
-				Range(-32767, 32767, 512),                   // speed
-				[]int{1024, 2000, 2448, 5056, 7168},         // wave, adsr, fx, sound
-				[]int{1024, 2000, 5056, 5824, 10526, 15360}, // blue, green, white, red
+				[]int{7168, 5056, 5280, 2000, 2144, 4688},         // sum, adsr, g, mic
+				Range(-32767, 32767, 512),                         // speed
+				[]int{1024, 2000, 2448, 5056, 7168},               // wave, adsr, fx, sound
+				[]int{1024, 2000, 4880, 5056, 5824, 10624, 15360}, // blue, green, white, red
 			},
 		},
+		Setting{Name: "midi"},
+		Setting{Name: "random"},
 		Setting{
-			Name: "tremelo",
+			Name: "tremolo",
 			Parameters: [][]int{
 				Range(16400, 32440, 512),  // speed
 				Range(-32767, 32767, 512), // pitch flucuation
 				Range(-32767, 32767, 512), // volume flucuation
-				// Range(0, 32767, 512),      // slope
-				// Range(0, 0, 512),          // n/a
-				// Range(0, 0, 512),          // n/a
-				// Range(0, 0, 512),          // n/a
-				// []int{0, 9216},            // wave, triangle TODO: get rest of these parameters
+				Range(0, 32767, 512),      // slope
+				Range(0, 0, 512),          // n/a
+				Range(0, 0, 512),          // n/a
+				Range(0, 0, 512),          // n/a
+				[]int{0, 9216},            // envelope off, on
 			},
 		},
+		Setting{Name: "value"},
 	}
 )
 
@@ -219,38 +245,12 @@ func NewSynthSamplePatch(freq ...float64) (sd SynthPatch) {
 	return
 }
 
-func RandomSynthPatch(seed ...int64) (sd SynthPatch) {
-	sd = NewSynthPatch()
-
-	if len(seed) > 0 {
-		rand.Seed(seed[0])
-	}
-	for i := 0; i < len(AllowedADSR); i++ {
-		sd.Adsr[i] = AllowedADSR[i][rand.Intn(len(AllowedADSR[i]))]
-	}
-
-	setting := AllowedEngine[rand.Intn(len(AllowedEngine))]
-	sd.Type = setting.Name
-	for i := 0; i < len(setting.Parameters); i++ {
-		sd.Knobs[i] = setting.Parameters[i][rand.Intn(len(setting.Parameters[i]))]
+// SetDevice sets the target device, along with the metadata version for sampler patches
+func (s *SynthPatch) SetDevice(d Device) {
+	s.Device = d
+	if s.Type == "sampler" {
+		s.SynthVersion = d.SynthVersion
 	}
-
-	setting = AllowedEffects[rand.Intn(len(AllowedEffects))]
-	sd.FxType = setting.Name
-	for i := 0; i < len(setting.Parameters); i++ {
-		sd.FxParams[i] = setting.Parameters[i][rand.Intn(len(setting.Parameters[i]))]
-	}
-	sd.FxActive = true
-
-	setting = AllowedLFO[rand.Intn(len(AllowedLFO))]
-	sd.LfoType = setting.Name
-	for i := 0; i < len(setting.Parameters); i++ {
-		sd.LfoParams[i] = setting.Parameters[i][rand.Intn(len(setting.Parameters[i]))]
-	}
-	sd.LfoActive = true
-
-	sd.Name = strings.Split(sd.Encode(), "-")[0]
-	return
 }
 
 func (s SynthPatch) Encode() (encoded string) {
@@ -301,6 +301,20 @@ func (s SynthPatch) Check() (err error) {
 		}
 	}
 
+	// check the names of the engine, effect and lfo
+	if s.Type != "sampler" && !hasSetting(AllowedEngine, s.Type) {
+		err = fmt.Errorf("unknown engine '%s'", s.Type)
+		return
+	}
+	if !hasSetting(AllowedEffects, s.FxType) {
+		err = fmt.Errorf("unknown effect '%s'", s.FxType)
+		return
+	}
+	if !hasSetting(AllowedLFO, s.LfoType) {
+		err = fmt.Errorf("unknown lfo '%s'", s.LfoType)
+		return
+	}
+
 	// check engine knobs
 	for _, setting := range AllowedEngine {
 		if setting.Name != s.Type {
@@ -341,72 +355,67 @@ func (s SynthPatch) Check() (err error) {
 	return
 }
 
+// ReadSynthPatch reads the metadata of a sampler or synth engine patch
 func ReadSynthPatch(fname string) (sp SynthPatch, err error) {
-	b, err := ioutil.ReadFile(fname)
+	patchType, err := readMetadata(fname, &sp)
 	if err != nil {
 		return
 	}
-
-	index1 := bytes.Index(b, []byte("op-1"))
-	if index1 < 0 {
-		err = fmt.Errorf("could not find header in '%s'", fname)
-		return
-	}
-	index2 := bytes.Index(b[index1:], []byte("}"))
-	if index2 < 0 {
-		err = fmt.Errorf("could not find JSON end in '%s'", fname)
-		return
+	if patchType == "drum" {
+		err = fmt.Errorf("'%s' is a drum patch", fname)
 	}
-
-	fmt.Println(string(b[index1+4 : index2+index1+1]))
-	err = json.Unmarshal(b[index1+4:index2+index1+1], &sp)
-
 	return
 }
 
 // Build a synth patch from a file
 func (s SynthPatch) SaveSample(fname string, fnameout string, trimSilence bool) (err error) {
+	b, err := audio.Decode(fname)
+	if err != nil {
+		return
+	}
+	return s.SaveSampleBuffer(b, fnameout, trimSilence)
+}
+
+// SaveSampleBuffer builds a synth patch from decoded audio
+func (s SynthPatch) SaveSampleBuffer(b *audio.Buffer, fnameout string, trimSilence bool) (err error) {
 	startClip := 0.0
 	if trimSilence {
-		var silenceSegments []models.AudioSegment
-		silenceSegments, err = ffmpeg.SplitOnSilence(fname, -30, .02, 0)
-		if err != nil {
-			return
-		}
-		logger.Debugf("silenceSegments: %+v", silenceSegments)
-		if silenceSegments[0].End < 2 {
-			startClip = silenceSegments[0].End
-		} else if silenceSegments[0].Start < 2 {
-			startClip = silenceSegments[0].Start
+		if start := b.FirstSound(-30); start < 2 {
+			startClip = start
 		}
+		logger.Debugf("startClip: %2.3f", startClip)
 	}
 
-	// generate a truncated, merged audio waveform, downsampled to 1 channel
-	fnameDownsampled := fname + ".down.aif"
-	defer os.Remove(fnameDownsampled)
-	cmd := []string{"-y", "-i", fname, "-ss",
-		fmt.Sprintf("%2.4f", startClip), "-to", fmt.Sprintf("%2.4f", startClip+5.75),
-		"-ar", "44100", "-ac", "1", fnameDownsampled}
-	logger.Debug(cmd)
-	out, err := exec.Command("ffmpeg", cmd...).CombinedOutput()
-	if err != nil {
-		logger.Errorf("ffmpeg: %s", out)
-		return
+	// truncate and resample for the device, and normalize
+	device := s.Device.orDefault()
+	b = b.Trim(startClip, startClip+device.SynthSeconds).Convert(device.SampleRate, device.Channels, 0)
+	n := s.Normalization
+	if n.Mode == "" {
+		n = audio.DefaultNormalization
 	}
+	n.Apply(b)
+	f := b.AIFF()
+	err = s.save(f, fnameout)
+	return
+}
 
-	// normalize
-	fnameNormalized := fname + ".norm.aif"
-	defer os.Remove(fnameNormalized)
-	err = ffmpeg.Normalize(fnameDownsampled, fnameNormalized)
+func (s SynthPatch) SaveSynth(fnameOut string, fnamein ...string) (err error) {
+	// use the default robot op-1 patch if no audio is given
+	var f aiff.File
+	if len(fnamein) > 0 {
+		f, err = aiff.ReadFile(fnamein[0])
+	} else {
+		f, err = aiff.Decode(defaultSynthAif)
+	}
 	if err != nil {
 		return
 	}
-
-	err = s.SaveSynth(fnameout, fnameNormalized)
+	err = s.save(f, fnameOut)
 	return
 }
 
-func (s SynthPatch) SaveSynth(fnameOut string, fnamein ...string) (err error) {
+// save writes the patch into the aiff file
+func (s SynthPatch) save(f aiff.File, fnameOut string) (err error) {
 	if !strings.HasSuffix(fnameOut, ".aif") {
 		err = fmt.Errorf("%s does not have .aif", fnameOut)
 		return
@@ -417,75 +426,11 @@ func (s SynthPatch) SaveSynth(fnameOut string, fnamein ...string) (err error) {
 		return
 	}
 
-	// clip out the current data
-	var b []byte
-	if len(fnamein) > 0 {
-		b, err = ioutil.ReadFile(fnamein[0])
-		if err != nil {
-			return
-		}
-	} else {
-		// use the default robot op-1 patch
-		b = append([]byte{}, defaultSynthAif...)
-		index1 := bytes.Index(b, []byte("APPL"))
-		if index1 < 0 {
-			err = fmt.Errorf("could not find header ")
-			return
-		}
-		index2 := bytes.Index(b, []byte("SSND"))
-		if index2 < 0 {
-			err = fmt.Errorf("could not find JSON end")
-			return
-		}
-		b = append(b[:index1], b[index2:]...)
-	}
-
-	ssndTagPosition := bytes.Index(b, []byte("SSND"))
-	if ssndTagPosition < 0 {
-		err = fmt.Errorf("no SND tag")
-		return
-	}
-
-	op1dataBytes, err := json.Marshal(s)
+	err = setMetadata(&f, s, 2)
 	if err != nil {
 		return
 	}
-
-	// filler is to pad the aif file so that it is a multiple of 4
-	filler := []byte{10}
-	for {
-		b2 := append([]byte{}, b[:ssndTagPosition]...)
-		// 4 bytes for AAPL tag, required to initiate op-1 data
-		b2 = append(b2, []byte{65, 80, 80, 76}...)
-		// 4 bytes to delcare size
-		bsSize := make([]byte, 4)
-		binary.BigEndian.PutUint32(bsSize, uint32(4+len(filler)+len(op1dataBytes)))
-		b2 = append(b2, bsSize...)
-		// 4 bytes to write magic op-1
-		b2 = append(b2, []byte{111, 112, 45, 49}...)
-		// write the op1 meta data
-		b2 = append(b2, op1dataBytes...)
-		// add filler
-		b2 = append(b2, filler...)
-		// write the rest of the bytes
-		b2 = append(b2, b[ssndTagPosition:]...)
-
-		// set bytes 4-8 with the total size - 8 bytes
-		totalsize := len(b2) - 8
-		bsTotalSize := make([]byte, 4)
-		binary.BigEndian.PutUint32(bsTotalSize, uint32(totalsize))
-		b3 := append([]byte{}, b2[:4]...)
-		b3 = append(b3, bsTotalSize...)
-		b3 = append(b3, b2[8:]...)
-
-		// repeat until the the total bytes is a multiple of 2
-		if math.Mod(float64(totalsize), 2.0) == 0 {
-			err = ioutil.WriteFile(fnameOut, b3, 0644)
-			break
-		} else {
-			filler = append(filler, []byte{30}...)
-		}
-	}
+	err = f.WriteFile(fnameOut)
 	return
 }
 
@@ -529,6 +474,15 @@ func Hashid(ints []int) string {
 	return id
 }
 
+func hasString(list []string, val string) bool {
+	for _, val2 := range list {
+		if val == val2 {
+			return true
+		}
+	}
+	return false
+}
+
 func Has(list []int, val int) bool {
 	for _, val2 := range list {
 		if val == val2 {
@@ -1,6 +1,7 @@
 package op1
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,3 +11,81 @@ func TestBuildSynth(t *testing.T) {
 	sp := NewSynthPatch()
 	assert.Nil(t, sp.SaveSample("Piano.mf.D3.aiff", "mfd3.aif", true))
 }
+
+func TestSynthPatchCheck(t *testing.T) {
+	// every patch saved on the device is allowed
+	fnames, err := filepath.Glob("reverse/*/*.aif")
+	assert.Nil(t, err)
+	more, err := filepath.Glob("reverse/*/*/*.aif")
+	assert.Nil(t, err)
+	fnames = append(fnames, more...)
+	assert.True(t, len(fnames) > 30)
+	for _, fname := range fnames {
+		sp, err := ReadSynthPatch(fname)
+		assert.Nil(t, err)
+		assert.Nil(t, sp.Check(), fname)
+	}
+
+	sp, err := ReadSynthPatch("reverse/lfo/tremelo/maxspeed_100_100_maxslope_env1.aif")
+	assert.Nil(t, err)
+	assert.Equal(t, "tremolo", sp.LfoType)
+	sp.LfoParams[7] = 100
+	assert.NotNil(t, sp.Check())
+
+	// the portamento values are the ones saved on the device
+	for fname, portamento := range map[string]int{
+		"reverse/portamendo/portamendo_off.aif": 64,
+		"reverse/portamendo/portamendo1.aif":    192,
+		"reverse/portamendo/portamendo_127.aif": 16320,
+	} {
+		sp, err = ReadSynthPatch(fname)
+		assert.Nil(t, err)
+		assert.Equal(t, portamento, sp.Adsr[Portamendo], fname)
+		assert.Contains(t, AllowedADSR[Portamendo], portamento)
+	}
+
+	sp = NewSynthPatch()
+	sp.Type = "organ"
+	assert.NotNil(t, sp.Check())
+	sp = NewSynthPatch()
+	sp.FxType = "reverb"
+	assert.NotNil(t, sp.Check())
+	sp = NewSynthPatch()
+	sp.LfoType = "tremelo"
+	assert.NotNil(t, sp.Check())
+	assert.Nil(t, NewSynthSamplePatch(440).Check())
+}
+
+func TestAllowedSettings(t *testing.T) {
+	var names []string
+	for _, setting := range AllowedEffects {
+		names = append(names, setting.Name)
+	}
+	assert.ElementsMatch(t, FxTypes, names)
+	names = nil
+	for _, setting := range AllowedLFO {
+		names = append(names, setting.Name)
+	}
+	assert.ElementsMatch(t, LfoTypes, names)
+
+	// fm is only known from patches of the device, so any value is allowed
+	sp, err := ReadSynthPatch("reverse/portamendo/portamendo1.aif")
+	assert.Nil(t, err)
+	assert.Equal(t, "fm", sp.Type)
+	assert.Nil(t, sp.Check())
+	sp.Knobs[0] = -32768
+	sp.FxType = "spring"
+	sp.FxParams[1] = -14337
+	assert.Nil(t, sp.Check())
+
+	// random patches only use measured settings
+	_, err = RandomSynthPatches(1, 1, Constraints{Engines: []string{"fm"}})
+	assert.NotNil(t, err)
+	patches, err := RandomSynthPatches(50, 1, Constraints{})
+	assert.Nil(t, err)
+	for _, sp := range patches {
+		assert.NotNil(t, allowedParameters(AllowedEngine, sp.Type))
+		assert.NotNil(t, allowedParameters(AllowedEffects, sp.FxType))
+		assert.NotNil(t, allowedParameters(AllowedLFO, sp.LfoType))
+	}
+}
@@ -0,0 +1,237 @@
+package pitch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	log "github.com/schollz/logger"
+	"github.com/schollz/teoperator/src/audio"
+)
+
+// MinConfidence is the confidence below which a detected pitch is not used
+const MinConfidence = 0.5
+
+// settings for the analysis
+const (
+	sampleRate = 44100
+	// seconds of the sample that are analysed
+	analyseSeconds = 2.0
+	// window is the number of samples summed for each lag, which also
+	// is the longest period that can be found (~43 hz)
+	window = 1024
+	hop    = 512
+	// threshold of the normalized difference for picking a period
+	threshold = 0.15
+	// number of agreeing frames that make a stable part
+	stableFrames = 4
+	// frames quieter than this fraction of the loudest frame are skipped
+	silence = 0.1
+)
+
+var noteNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// Result is a detected pitch
+type Result struct {
+	Frequency float64
+	// Note is the closest note, like "A4"
+	Note string
+	// Cents is how far the frequency is from the note
+	Cents float64
+	// Confidence is between 0 and 1
+	Confidence float64
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s%+.0f cents (%2.1f hz, %2.0f%% confidence)", r.Note, r.Cents, r.Frequency, r.Confidence*100)
+}
+
+// DetectFile finds the root pitch of the start of any audio file
+func DetectFile(fname string) (r Result, err error) {
+	b, err := audio.Decode(fname)
+	if err != nil {
+		return
+	}
+	return DetectBuffer(b)
+}
+
+// DetectBuffer finds the root pitch of the start of decoded audio
+func DetectBuffer(b *audio.Buffer) (r Result, err error) {
+	return Detect(b.Convert(sampleRate, 1, analyseSeconds).Samples, sampleRate)
+}
+
+// Detect finds the pitch of the first stable part of the samples, skipping
+// silence and the attack. If there is no stable part it returns the most
+// confident frame.
+func Detect(samples []float64, sampleRate int) (r Result, err error) {
+	if len(samples) < 2*window {
+		err = fmt.Errorf("sample is too short to detect pitch")
+		return
+	}
+
+	var frames []Result
+	var rms []float64
+	maxRMS := 0.0
+	for i := 0; i+2*window <= len(samples); i += hop {
+		frame := samples[i : i+2*window]
+		freq, confidence := YIN(frame, sampleRate, threshold)
+		frames = append(frames, Result{Frequency: freq, Confidence: confidence})
+		rms = append(rms, rootMeanSquare(frame[:window]))
+		if rms[len(rms)-1] > maxRMS {
+			maxRMS = rms[len(rms)-1]
+		}
+	}
+	if maxRMS == 0 {
+		err = fmt.Errorf("sample is silent")
+		return
+	}
+
+	// skip ahead of the loudest part of the attack
+	start := 0
+	for i := range rms {
+		if rms[i] == maxRMS {
+			start = i
+			break
+		}
+	}
+
+	best := -1
+	for i := start; i < len(frames); i++ {
+		if rms[i] < silence*maxRMS || frames[i].Frequency == 0 {
+			continue
+		}
+		if best < 0 || frames[i].Confidence > frames[best].Confidence {
+			best = i
+		}
+		if i+stableFrames > len(frames) {
+			continue
+		}
+		run := frames[i : i+stableFrames]
+		if stable(run) {
+			freqs := make([]float64, len(run))
+			confidence := 0.0
+			for j, f := range run {
+				freqs[j] = f.Frequency
+				confidence += f.Confidence / float64(len(run))
+			}
+			sort.Float64s(freqs)
+			r = newResult(freqs[len(freqs)/2], confidence)
+			log.Debugf("stable pitch at frame %d: %s", i, r)
+			return
+		}
+	}
+	if best < 0 {
+		err = fmt.Errorf("could not detect pitch")
+		return
+	}
+	r = newResult(frames[best].Frequency, frames[best].Confidence)
+	log.Debugf("unstable pitch at frame %d: %s", best, r)
+	return
+}
+
+// stable returns whether frames are confident and within a quarter tone
+func stable(frames []Result) bool {
+	for _, f := range frames {
+		if f.Confidence < 1-threshold || f.Frequency == 0 {
+			return false
+		}
+		if math.Abs(1200*math.Log2(f.Frequency/frames[0].Frequency)) > 50 {
+			return false
+		}
+	}
+	return true
+}
+
+// YIN estimates the frequency of a frame using the YIN algorithm
+// (de Cheveigné and Kawahara, 2002). The frame should hold at least two
+// periods of the lowest frequency. The confidence is between 0 and 1.
+func YIN(frame []float64, sampleRate int, threshold float64) (freq float64, confidence float64) {
+	w := len(frame) / 2
+	if w < 2 {
+		return
+	}
+
+	// difference function
+	d := make([]float64, w)
+	for tau := 1; tau < w; tau++ {
+		for j := 0; j < w; j++ {
+			delta := frame[j] - frame[j+tau]
+			d[tau] += delta * delta
+		}
+	}
+
+	// cumulative mean normalized difference
+	d[0] = 1
+	sum := 0.0
+	for tau := 1; tau < w; tau++ {
+		sum += d[tau]
+		if sum == 0 {
+			d[tau] = 1
+		} else {
+			d[tau] *= float64(tau) / sum
+		}
+	}
+
+	// first dip under the threshold, or the lowest dip
+	period := 0
+	for tau := 2; tau < w; tau++ {
+		if d[tau] < threshold {
+			for tau+1 < w && d[tau+1] < d[tau] {
+				tau++
+			}
+			period = tau
+			break
+		}
+	}
+	if period == 0 {
+		for tau := 2; tau < w; tau++ {
+			if period == 0 || d[tau] < d[period] {
+				period = tau
+			}
+		}
+	}
+	if period == 0 || period == w-1 {
+		return
+	}
+
+	// parabolic interpolation around the dip
+	betterPeriod := float64(period)
+	a, b, c := d[period-1], d[period], d[period+1]
+	if denominator := a - 2*b + c; denominator != 0 {
+		betterPeriod += (a - c) / (2 * denominator)
+	}
+	freq = float64(sampleRate) / betterPeriod
+	confidence = math.Max(0, math.Min(1, 1-b))
+	return
+}
+
+// Note returns the name of the closest note, like "A4", and the
+// difference to it in cents
+func Note(freq float64) (name string, cents float64) {
+	if freq <= 0 {
+		return
+	}
+	midi := 69 + 12*math.Log2(freq/440)
+	closest := int(math.Round(midi))
+	cents = (midi - float64(closest)) * 100
+	octave := closest/12 - 1
+	if closest < 0 {
+		octave = (closest-11)/12 - 1
+	}
+	name = fmt.Sprintf("%s%d", noteNames[(closest%12+12)%12], octave)
+	return
+}
+
+func newResult(freq float64, confidence float64) (r Result) {
+	r = Result{Frequency: freq, Confidence: confidence}
+	r.Note, r.Cents = Note(freq)
+	return
+}
+
+func rootMeanSquare(frame []float64) float64 {
+	sum := 0.0
+	for _, x := range frame {
+		sum += x * x
+	}
+	return math.Sqrt(sum / float64(len(frame)))
+}
@@ -0,0 +1,50 @@
+package pitch
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tone makes a decaying sawtooth with a short noisy attack
+func tone(freq float64, seconds float64) (samples []float64) {
+	samples = make([]float64, int(seconds*sampleRate))
+	for i := range samples {
+		t := float64(i) / sampleRate
+		phase := math.Mod(t*freq, 1)
+		samples[i] = (2*phase - 1) * math.Exp(-t)
+		if i < 500 {
+			samples[i] += math.Sin(float64(i*i)) * 0.5
+		}
+	}
+	return
+}
+
+func TestDetect(t *testing.T) {
+	for _, freq := range []float64{55, 110, 220, 261.63, 440, 880, 1760} {
+		r, err := Detect(tone(freq, 1), sampleRate)
+		assert.Nil(t, err)
+		assert.InDelta(t, 0, 1200*math.Log2(r.Frequency/freq), 10, "%2.2f hz: %s", freq, r)
+		assert.True(t, r.Confidence > MinConfidence)
+	}
+
+	_, err := Detect(make([]float64, sampleRate), sampleRate)
+	assert.NotNil(t, err)
+	_, err = Detect(make([]float64, 100), sampleRate)
+	assert.NotNil(t, err)
+}
+
+func TestNote(t *testing.T) {
+	name, cents := Note(440)
+	assert.Equal(t, "A4", name)
+	assert.InDelta(t, 0, cents, 0.01)
+	name, cents = Note(261.63)
+	assert.Equal(t, "C4", name)
+	assert.InDelta(t, 0, cents, 0.1)
+	name, cents = Note(450)
+	assert.Equal(t, "A4", name)
+	assert.InDelta(t, 38.9, cents, 0.1)
+	name, _ = Note(27.5)
+	assert.Equal(t, "A0", name)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"crypto/md5"
 	"embed"
 	"encoding/json"
@@ -12,7 +13,6 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"sort"
@@ -25,12 +25,14 @@ import (
 	"github.com/schollz/httpfileserver"
 	"github.com/schollz/logger"
 	log "github.com/schollz/logger"
+	"github.com/schollz/teoperator/src/audio"
 	"github.com/schollz/teoperator/src/audiosegment"
+	"github.com/schollz/teoperator/src/command"
+	"github.com/schollz/teoperator/src/convert"
 	"github.com/schollz/teoperator/src/download"
-	"github.com/schollz/teoperator/src/ffmpeg"
 	"github.com/schollz/teoperator/src/models"
+	"github.com/schollz/teoperator/src/onset"
 	"github.com/schollz/teoperator/src/op1"
-	"github.com/schollz/teoperator/src/utils"
 )
 
 //go:embed static templates
@@ -47,6 +49,18 @@ var uploadsInProgress map[string]int
 var uploadsFileNames map[string]string
 var serverName string
 
+// maxRandomPatches is the most random synth patches made at once
+const maxRandomPatches = 64
+
+// zeroCrossingSeconds is searched around slice points for a zero crossing
+const zeroCrossingSeconds = 0.005
+
+// timeouts for making a patch and drawing its waveform
+const (
+	processTimeout  = 10 * time.Minute
+	waveformTimeout = time.Minute
+)
+
 var rootNoteToFrequency = map[string]float64{
 	"A#": math.Pow(2.0, ((58.0-69.0)/12.0)) * 440.0,
 	"B":  math.Pow(2.0, ((59.0-69.0)/12.0)) * 440.0,
@@ -107,7 +121,14 @@ type Metadata struct {
 	IsSynthPatch  bool
 	RemoveSilence bool
 	RootNote      string
-	Splices       int
+	DetectedNote  string
+	Normalize     string
+	PerSlice      bool
+	// ZeroCrossing moves slice points to zero crossings
+	ZeroCrossing bool
+	Splices      int
+	Keys         string
+	Device       string
 }
 
 type FileData struct {
@@ -121,6 +142,26 @@ type Render struct {
 	MessageError string
 	MessageInfo  string
 	Metadata     Metadata
+	Random       RandomBank
+}
+
+// RandomBank is a bank of random synth patches
+type RandomBank struct {
+	Number    int
+	MaxNumber int
+	Seed      int64
+	// Engines, Effects and LFOs are the settings to choose from, flagged
+	// if they are chosen
+	Engines []Href
+	Effects []Href
+	LFOs    []Href
+	// Attack, Decay, Sustain and Release are bounds like "64:4000"
+	Attack  string
+	Decay   string
+	Sustain string
+	Release string
+	// Files are the paths of the patches
+	Files []string
 }
 
 var t map[string]*template.Template
@@ -172,7 +213,7 @@ func loadTemplates() {
 			return fmt.Sprintf("%2.1f", f)
 		},
 	}
-	for _, templateName := range []string{"main"} {
+	for _, templateName := range []string{"main", "random"} {
 		b, err := content.ReadFile("templates/base.html")
 		if err != nil {
 			panic(err)
@@ -206,6 +247,8 @@ func handle(w http.ResponseWriter, r *http.Request) (err error) {
 		return handlePost(w, r)
 	} else if r.URL.Path == "/patch" {
 		return viewPatch(w, r)
+	} else if r.URL.Path == "/random" {
+		return viewRandom(w, r)
 	} else {
 		t["main"].Execute(w, Render{})
 	}
@@ -338,9 +381,14 @@ func viewPatch(w http.ResponseWriter, r *http.Request) (err error) {
 	removeSilenceA, _ := r.URL.Query()["removeSilence"]
 	rootNoteA, _ := r.URL.Query()["rootNote"]
 	splicesA, _ := r.URL.Query()["splices"]
+	keysA, _ := r.URL.Query()["keys"]
+	deviceA, _ := r.URL.Query()["device"]
+	normalizeA, _ := r.URL.Query()["normalize"]
+	perSliceA, _ := r.URL.Query()["perSlice"]
+	zeroCrossingA, _ := r.URL.Query()["zeroCrossing"]
 	patchtype := "drum"
 	removeSilence := false
-	rootNote := "A"
+	rootNote := "auto"
 	if len(patchtypeA) > 0 && (patchtypeA[0] == "synth" || patchtypeA[0] == "on") {
 		patchtype = "synth"
 	}
@@ -348,7 +396,7 @@ func viewPatch(w http.ResponseWriter, r *http.Request) (err error) {
 		removeSilence = true
 	}
 	if len(rootNoteA) > 0 {
-		if _, ok := rootNoteToFrequency[rootNoteA[0]]; ok {
+		if _, ok := rootNoteToFrequency[rootNoteA[0]]; ok || rootNoteA[0] == "auto" {
 			rootNote = rootNoteA[0]
 		}
 	}
@@ -371,8 +419,52 @@ func viewPatch(w http.ResponseWriter, r *http.Request) (err error) {
 		splices, _ = strconv.Atoi(splicesA[0])
 	}
 	log.Debugf("splices: %d", splices)
+	keys := ""
+	if len(keysA) > 0 && patchtype == "drum" {
+		keys = strings.TrimSpace(keysA[0])
+		// validate the key settings before doing any work
+		dp := op1.NewDrumPatch()
+		err = dp.EditKeys(keys)
+		if err != nil {
+			return
+		}
+	}
+
+	device := op1.OP1
+	if len(deviceA) > 0 {
+		device, err = op1.GetDevice(deviceA[0])
+		if err != nil {
+			return
+		}
+	}
+
+	// the patch is not made if the request is cancelled or takes too long
+	ctx, cancel := context.WithTimeout(r.Context(), processTimeout)
+	defer cancel()
+	// the level is the default of the patch type if it is not set
+	normalize := ""
+	if len(normalizeA) > 0 && normalizeA[0] != "" {
+		normalize = normalizeA[0]
+		_, err = audio.ParseNormalization(normalize)
+		if err != nil {
+			return
+		}
+	}
+	perSlice := len(perSliceA) > 0 && perSliceA[0] == "yes" && patchtype == "drum"
+	if perSlice {
+		// each slice is leveled to its peak unless another level is chosen
+		if normalize == "" {
+			normalize = audio.Peak
+		} else if normalize == audio.None {
+			err = fmt.Errorf("each slice needs a normalization other than none")
+			return
+		}
+	}
 
-	uuid, err := generateUserData(audioURL[0], startStop, patchtype, removeSilence, rootNote, splices)
+	// slice points are only moved to zero crossings if it is turned on
+	zeroCrossing := len(zeroCrossingA) > 0 && zeroCrossingA[0] == "yes"
+
+	uuid, err := generateUserData(ctx, audioURL[0], startStop, patchtype, removeSilence, rootNote, splices, keys, device.Name, normalize, perSlice, zeroCrossing)
 	if err != nil {
 		return
 	}
@@ -393,6 +485,105 @@ func viewPatch(w http.ResponseWriter, r *http.Request) (err error) {
 	return
 }
 
+// viewRandom makes a bank of random synth patches from the query, or shows
+// the form with a new seed
+func viewRandom(w http.ResponseWriter, r *http.Request) (err error) {
+	query := r.URL.Query()
+	bank := RandomBank{
+		Number:    8,
+		MaxNumber: maxRandomPatches,
+		Seed:      time.Now().UnixNano() % 1000000,
+		Attack:    query.Get("attack"),
+		Decay:     query.Get("decay"),
+		Sustain:   query.Get("sustain"),
+		Release:   query.Get("release"),
+	}
+	options := func(settings []op1.Setting, chosen []string) (hrefs []Href) {
+		for _, setting := range settings {
+			// random patches only use measured settings
+			if setting.Parameters != nil {
+				hrefs = append(hrefs, Href{Value: setting.Name, Flag: hasString(chosen, setting.Name)})
+			}
+		}
+		return
+	}
+	bank.Engines = options(op1.AllowedEngine, query["engine"])
+	bank.Effects = options(op1.AllowedEffects, query["fx"])
+	bank.LFOs = options(op1.AllowedLFO, query["lfo"])
+
+	render := func(messageError string) {
+		t["random"].Execute(w, Render{
+			Title:        "teoperator | random synth patches",
+			MessageError: messageError,
+			Random:       bank,
+		})
+	}
+	if query.Get("seed") == "" {
+		render("")
+		return
+	}
+
+	bank.Seed, err = strconv.ParseInt(query.Get("seed"), 10, 64)
+	if err != nil {
+		render("seed should be a number")
+		return nil
+	}
+	bank.Number, err = strconv.Atoi(query.Get("number"))
+	if err != nil || bank.Number < 1 || bank.Number > maxRandomPatches {
+		render(fmt.Sprintf("number of patches should be 1 to %d", maxRandomPatches))
+		return nil
+	}
+	constraints := op1.Constraints{
+		Engines: query["engine"],
+		Effects: query["fx"],
+		LFOs:    query["lfo"],
+	}
+	for i, s := range []string{bank.Attack, bank.Decay, bank.Sustain, bank.Release} {
+		if s == "" {
+			continue
+		}
+		bounds, err := op1.ParseBounds(s)
+		if err != nil {
+			render(err.Error())
+			return nil
+		}
+		constraints.ADSR[i] = &bounds
+	}
+	patches, err := op1.RandomSynthPatches(bank.Number, bank.Seed, constraints)
+	if err != nil {
+		render(err.Error())
+		return nil
+	}
+
+	// the same query makes the same files
+	folder := path.Join("data", "random", fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%d%+v", bank.Seed, constraints))))[:8])
+	err = os.MkdirAll(folder, os.ModePerm)
+	if err != nil {
+		return
+	}
+	for _, patch := range patches {
+		fname := path.Join(folder, patch.Encode()+".aif")
+		if _, errStat := os.Stat(fname); errStat != nil {
+			err = patch.SaveSynth(fname)
+			if err != nil {
+				return
+			}
+		}
+		bank.Files = append(bank.Files, fname)
+	}
+	render("")
+	return
+}
+
+func hasString(list []string, s string) bool {
+	for _, s2 := range list {
+		if s == s2 {
+			return true
+		}
+	}
+	return false
+}
+
 func viewMain(w http.ResponseWriter, r *http.Request, messageError string, templateName string) (err error) {
 
 	t[templateName].Execute(w, Render{
@@ -402,17 +593,29 @@ func viewMain(w http.ResponseWriter, r *http.Request, messageError string, templ
 	return
 }
 
-func generateUserData(u string, startStop []float64, patchType string, removeSilence bool, rootNote string, splices int) (uuid string, err error) {
+func generateUserData(ctx context.Context, u string, startStop []float64, patchType string, removeSilence bool, rootNote string, splices int, keys string, deviceName string, normalize string, perSlice bool, zeroCrossing bool) (uuid string, err error) {
 	log.Debug(u, startStop)
 	log.Debug(patchType)
-	if startStop[1]-startStop[0] < 12 {
-		startStop[1] = startStop[0] + 12
+	device, err := op1.GetDevice(deviceName)
+	if err != nil {
+		return
+	}
+	var normalization audio.Normalization
+	if normalize != "" {
+		normalization, err = audio.ParseNormalization(normalize)
+		if err != nil {
+			return
+		}
+	}
+	normalization.PerSlice = perSlice
+	if startStop[1]-startStop[0] < device.DrumSeconds {
+		startStop[1] = startStop[0] + device.DrumSeconds
 	}
 	if patchType != "drum" {
-		startStop[1] = startStop[0] + 5.75
+		startStop[1] = startStop[0] + device.SynthSeconds
 	}
 
-	uuid = fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%+v %+v %+v %+v %+v %+v", patchType, u, startStop, removeSilence, rootNote, splices))))
+	uuid = fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%+v %+v %+v %+v %+v %+v %+v %+v %+v %+v %+v", patchType, u, startStop, removeSilence, rootNote, splices, keys, device.Name, normalize, perSlice, zeroCrossing))))
 
 	// create path to data
 	pathToData := path.Join("data", uuid)
@@ -427,6 +630,12 @@ func generateUserData(u string, startStop []float64, patchType string, removeSil
 	if err != nil {
 		return
 	}
+	// an unfinished folder would be mistaken for a finished one
+	defer func() {
+		if err != nil {
+			os.RemoveAll(pathToData)
+		}
+	}()
 
 	// find filename of downloaded file
 	fname := ""
@@ -455,37 +664,22 @@ func generateUserData(u string, startStop []float64, patchType string, removeSil
 	folder0, _ := filepath.Split(fname)
 	shortName := fmt.Sprintf("%x%s", md5.Sum([]byte(u+fmt.Sprintf("%+v", startStop))), filepath.Ext(fname))
 	shortName = shortName[:6]
-	shortName = path.Join(folder0, shortName+filepath.Ext(fname))
-
-	// // copy file into folder
-	// _, err = utils.CopyFile(fnameID, fname)
-	// if err != nil {
-	// 	return
-	// }
-	// truncate into folder
-	err = audiosegment.Truncate(fnameID, shortName, utils.SecondsToString(startStop[0]), utils.SecondsToString(startStop[1]))
+	shortName = path.Join(folder0, shortName+".wav")
+
+	// truncate into folder, decoding only the requested part
+	clip, err := audio.DecodeRange(ctx, fnameID, startStop[0], startStop[1]-startStop[0])
 	if err != nil {
 		log.Error(err)
 		return
 	}
-
 	if removeSilence {
 		log.Debug("removing silence")
-		err = os.Rename(shortName, shortName+".wav")
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		err = ffmpeg.RemoveSilence(shortName+".wav", shortName)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		err = os.Remove(shortName + ".wav")
-		if err != nil {
-			log.Error(err)
-			return
-		}
+		clip = clip.RemoveSilence(-50, 0.1)
+	}
+	err = clip.WriteWAV(shortName)
+	if err != nil {
+		log.Error(err)
+		return
 	}
 
 	// remove upload if upload
@@ -501,13 +695,19 @@ func generateUserData(u string, startStop []float64, patchType string, removeSil
 
 	// generate patches
 	var segments [][]models.AudioSegment
+	detectedNote := ""
 	if patchType == "drum" {
-		segments, err = audiosegment.SplitEqual(shortName, 12, 1, splices)
+		snapSeconds := 0.0
+		if zeroCrossing {
+			snapSeconds = zeroCrossingSeconds
+		}
+		segments, err = audiosegment.SplitEqual(ctx, shortName, device.DrumSeconds, 1, splices, []string{keys}, device, onset.DefaultOptions, snapSeconds, normalization, audio.DefaultDeclick)
 		if err != nil {
 			return
 		}
 	} else {
-		segments, err = makeSynthPatch(shortName, rootNoteToFrequency[rootNote])
+		// the root note is detected if it is "auto"
+		segments, detectedNote, err = makeSynthPatch(ctx, shortName, clip, rootNoteToFrequency[rootNote], device, normalization)
 		if err != nil {
 			return
 		}
@@ -540,20 +740,35 @@ func generateUserData(u string, startStop []float64, patchType string, removeSil
 		IsSynthPatch:  patchType == "synth",
 		RemoveSilence: removeSilence,
 		RootNote:      rootNote,
+		DetectedNote:  detectedNote,
+		Normalize:     normalize,
+		PerSlice:      perSlice,
+		ZeroCrossing:  zeroCrossing,
 		Splices:       splices,
+		Keys:          keys,
+		Device:        device.Name,
 	})
 	err = ioutil.WriteFile(path.Join(pathToData, "metadata.json"), b, 0644)
 
 	return
 }
 
-func makeSynthPatch(fname string, rootFrequency float64) (segments [][]models.AudioSegment, err error) {
+func makeSynthPatch(ctx context.Context, fname string, clip *audio.Buffer, rootFrequency float64, device op1.Device, normalization audio.Normalization) (segments [][]models.AudioSegment, detectedNote string, err error) {
+	if rootFrequency == 0 {
+		var errDetect error
+		rootFrequency, detectedNote, errDetect = convert.DetectBufferBaseFreq(clip)
+		if errDetect != nil {
+			logger.Debugf("could not detect pitch: %s", errDetect)
+		}
+	}
 	sp := op1.NewSynthSamplePatch(rootFrequency)
+	sp.SetDevice(device)
+	sp.Normalization = normalization
 	basefolder, basefname := filepath.Split(fname)
 	sp.Name = strings.Split(basefname, ".")[0]
 	fnameout := path.Join(basefolder, strings.Split(basefname, ".")[0]+".aif")
 
-	err = sp.SaveSample(fname, fnameout, true)
+	err = sp.SaveSampleBuffer(clip, fnameout, true)
 	if err != nil {
 		return
 	}
@@ -562,28 +777,28 @@ func makeSynthPatch(fname string, rootFrequency float64) (segments [][]models.Au
 			models.AudioSegment{
 				Filename: fnameout,
 				StartAbs: 0,
-				EndAbs:   5.75,
+				EndAbs:   device.SynthSeconds,
 			},
 		},
 	}
 
+	// the waveform is drawn from the patch as it sounds on the device
 	fnamewav := path.Join(basefolder, strings.Split(basefname, ".")[0]+".wav")
-	cmd := []string{"-y", "-i", fnameout, fnamewav}
-	logger.Debug(cmd)
-	out, err := exec.Command("ffmpeg", cmd...).CombinedOutput()
-	logger.Debugf("ffmpeg: %s", out)
+	patchAudio, err := audio.Decode(fnameout)
+	if err != nil {
+		return
+	}
+	err = patchAudio.WriteWAV(fnamewav)
 	if err != nil {
-		err = fmt.Errorf("ffmpeg; %s", err.Error())
 		return
 	}
 
 	waveformfname := fnamewav + ".png"
-	cmd = []string{"-i", fnamewav, "-o", waveformfname, "--background-color", "ffffff00", "--waveform-color", "ffffff", "--amplitude-scale", "2", "--no-axis-labels", "--pixels-per-second", "100", "--height", "160", "--width",
-		fmt.Sprintf("%2.0f", 5.75*100)}
-	logger.Debug(cmd)
-	out, err = exec.Command("audiowaveform", cmd...).CombinedOutput()
+	cmd := []string{"-i", fnamewav, "-o", waveformfname, "--background-color", "ffffff00", "--waveform-color", "ffffff", "--amplitude-scale", "2", "--no-axis-labels", "--pixels-per-second", "100", "--height", "160", "--width",
+		fmt.Sprintf("%2.0f", device.SynthSeconds*100)}
+	_, _, err = command.Run(ctx, waveformTimeout, "audiowaveform", cmd...)
 	if err != nil {
-		logger.Errorf("audiowaveform: %s", out)
+		logger.Error(err)
 	}
 
 	return
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -14,6 +15,6 @@ func TestGenerateUserData(t *testing.T) {
 	os.Mkdir("data", os.ModePerm)
 	u := `https://upload.wikimedia.org/wikipedia/commons/6/68/Turdus_merula_male_song_at_dawn%2820s%29.ogg`
 	startStop := []float64{0, 10}
-	_, err := generateUserData(u, startStop)
+	_, err := generateUserData(context.Background(), u, startStop, "drum", false, "", 0, "", "op-1", "", false, true)
 	assert.Nil(t, err)
 }
@@ -0,0 +1,255 @@
+package tempo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	log "github.com/schollz/logger"
+	"github.com/schollz/teoperator/src/audio"
+	"github.com/schollz/teoperator/src/onset"
+)
+
+// range of detected tempos
+const (
+	MinBPM = 60
+	MaxBPM = 200
+)
+
+// SampleRate is the rate of positions in files
+const SampleRate = 44100
+
+const (
+	sampleRate = SampleRate
+	// tempos are preferred close to this, an octave away weighs ~60%
+	preferredBPM = 120
+	beatsPerBar  = 4
+)
+
+// Result is the tempo and beat grid of a loop
+type Result struct {
+	BPM float64
+	// Downbeat is the sample position of the first downbeat
+	Downbeat int
+}
+
+// DetectFile finds the tempo and first downbeat of any audio file.
+// If the bpm is given only the downbeat is detected.
+func DetectFile(fname string, bpm float64) (r Result, err error) {
+	b, err := audio.Decode(fname)
+	if err != nil {
+		return
+	}
+	return DetectBuffer(b, bpm)
+}
+
+// DetectBuffer finds the tempo and first downbeat of decoded audio, with
+// the downbeat at SampleRate
+func DetectBuffer(b *audio.Buffer, bpm float64) (r Result, err error) {
+	return Detect(b.Convert(sampleRate, 1, 0).Samples, sampleRate, bpm)
+}
+
+// Detect finds the tempo and first downbeat of mono samples. If the bpm
+// is given only the downbeat is detected.
+func Detect(samples []float64, sampleRate int, bpm float64) (r Result, err error) {
+	strength, err := onset.Strength(samples, onset.SpectralFlux)
+	if err != nil {
+		return
+	}
+	framesPerMinute := 60 * float64(sampleRate) / onset.Hop
+	if bpm <= 0 {
+		bpm, err = estimateBPM(strength, framesPerMinute)
+		if err != nil {
+			return
+		}
+	}
+	r.BPM = math.Round(bpm*10) / 10
+	period := framesPerMinute / bpm
+
+	// beats fall on the phase with the most onset strength
+	beat := bestPhase(strength, period)
+	// downbeats are the beat of the bar with the most bass,
+	// the earliest one wins if they are close
+	bass := bassStrength(samples, sampleRate)
+	downbeat := beat
+	best := 0.0
+	for b := 0; b < beatsPerBar; b++ {
+		phase := beat + float64(b)*period
+		score := sumAt(bass, phase, period*beatsPerBar, int(period/8))
+		if score > best*1.1 {
+			best = score
+			downbeat = phase
+		}
+	}
+	r.Downbeat = int(math.Round(downbeat * onset.Hop))
+
+	// snap to the onset of the downbeat
+	onsets, err := onset.Detect(samples, sampleRate, onset.DefaultOptions)
+	if err != nil {
+		return
+	}
+	tolerance := int(period * onset.Hop / 4)
+	for _, o := range onsets {
+		if o >= r.Downbeat-tolerance && o <= r.Downbeat+tolerance {
+			r.Downbeat = o
+			break
+		}
+	}
+	log.Debugf("tempo: %+v", r)
+	return
+}
+
+// estimateBPM finds the tempo with the strongest autocorrelation of the
+// onset strength, weighted towards common tempos
+func estimateBPM(strength []float64, framesPerMinute float64) (bpm float64, err error) {
+	minLag := int(framesPerMinute / MaxBPM)
+	maxLag := int(math.Ceil(framesPerMinute / MinBPM))
+	if len(strength) < 2*maxLag {
+		err = fmt.Errorf("sample is too short to detect tempo")
+		return
+	}
+
+	// smoothing keeps peaks that are a frame apart correlated
+	smooth := make([]float64, len(strength))
+	for i := range strength {
+		for j := i - 2; j <= i+2; j++ {
+			if j >= 0 && j < len(strength) {
+				smooth[i] += strength[j] * (3 - math.Abs(float64(i-j))) / 9
+			}
+		}
+	}
+	ac := make([]float64, 2*maxLag+2)
+	for lag := range ac {
+		for i := 0; i+lag < len(smooth); i++ {
+			ac[lag] += smooth[i] * smooth[i+lag]
+		}
+		ac[lag] /= float64(len(smooth) - lag)
+	}
+	near := func(lag float64) float64 {
+		return math.Max(ac[int(math.Floor(lag))], ac[int(math.Ceil(lag))])
+	}
+
+	bestLag := 0
+	best := 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		// a beat also lines up at twice its period, and most music has
+		// onsets halfway between beats
+		score := ac[lag] + 0.5*near(2*float64(lag)) + 0.5*near(float64(lag)/2)
+		weight := math.Exp(-0.5 * math.Pow(math.Log2(framesPerMinute/float64(lag)/preferredBPM), 2))
+		if score*weight > best {
+			best = score * weight
+			bestLag = lag
+		}
+	}
+	if bestLag == 0 {
+		err = fmt.Errorf("could not detect tempo")
+		return
+	}
+
+	// parabolic interpolation around the peak
+	lag := float64(bestLag)
+	a, b, c := ac[bestLag-1], ac[bestLag], ac[bestLag+1]
+	if denominator := a - 2*b + c; denominator != 0 {
+		lag += 0.5 * (a - c) / denominator
+	}
+	bpm = framesPerMinute / lag
+	return
+}
+
+// bassStrength returns the rise in low frequency energy for every
+// onset.Hop samples, compared to a few frames before as bass rises slowly
+func bassStrength(samples []float64, sampleRate int) (strength []float64) {
+	const rise = 4
+	// two one-pole lowpass filters at ~150 hz
+	a := 1 - math.Exp(-2*math.Pi*150/float64(sampleRate))
+	var y1, y2 float64
+	var energies []float64
+	for start := 0; start < len(samples); start += onset.Hop {
+		energy := 0.0
+		for i := start; i < start+onset.Hop && i < len(samples); i++ {
+			y1 += a * (samples[i] - y1)
+			y2 += a * (y1 - y2)
+			energy += y2 * y2
+		}
+		energies = append(energies, math.Log1p(1000*energy))
+	}
+	strength = make([]float64, len(energies))
+	for i := range energies {
+		before := energies[i]
+		for j := i - rise; j < i; j++ {
+			if j >= 0 {
+				before = math.Min(before, energies[j])
+			}
+		}
+		if i < rise {
+			before = math.Min(before, 0)
+		}
+		strength[i] = energies[i] - before
+	}
+	return
+}
+
+// bestPhase returns the phase within the first period with the most onset
+// strength on a grid of the period
+func bestPhase(strength []float64, period float64) (phase float64) {
+	best := -1.0
+	for p := 0.0; p < period; p++ {
+		score := sumAt(strength, p, period, 2)
+		if score > best {
+			best = score
+			phase = p
+		}
+	}
+	return
+}
+
+// sumAt sums the strongest onset strength around each point of a grid
+func sumAt(strength []float64, phase float64, period float64, tolerance int) (sum float64) {
+	for t := phase; t < float64(len(strength)); t += period {
+		value := 0.0
+		for i := int(math.Round(t)) - tolerance; i <= int(math.Round(t))+tolerance; i++ {
+			if i >= 0 && i < len(strength) {
+				value = math.Max(value, strength[i])
+			}
+		}
+		sum += value
+	}
+	return
+}
+
+// ParseGrid returns the beats per slice of a note value like "1/16"
+func ParseGrid(grid string) (beats float64, err error) {
+	parts := strings.Split(grid, "/")
+	if len(parts) != 2 {
+		err = fmt.Errorf("grid '%s' should be a note value like 1/16", grid)
+		return
+	}
+	numerator, err1 := strconv.ParseFloat(parts[0], 64)
+	denominator, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil || numerator <= 0 || denominator <= 0 {
+		err = fmt.Errorf("grid '%s' should be a note value like 1/16", grid)
+		return
+	}
+	beats = 4 * numerator / denominator
+	return
+}
+
+// Slices returns the start and end positions of at most maxSlices slices
+// of a grid, starting at the downbeat, in samples
+func (r Result) Slices(beatsPerSlice float64, sampleRate int, numSamples int, maxSlices int) (starts []int, ends []int) {
+	length := beatsPerSlice * 60 / r.BPM * float64(sampleRate)
+	for i := 0; i < maxSlices; i++ {
+		start := r.Downbeat + int(math.Round(float64(i)*length))
+		if start >= numSamples {
+			break
+		}
+		end := r.Downbeat + int(math.Round(float64(i+1)*length))
+		if end > numSamples {
+			end = numSamples
+		}
+		starts = append(starts, start)
+		ends = append(ends, end)
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package tempo
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loop makes a drum loop with a kick on every downbeat, snares on the
+// other beats and hats on the eighths, after a pickup
+func loop(bpm float64, pickup float64, bars int) (samples []float64) {
+	r := rand.New(rand.NewSource(1))
+	beat := 60 / bpm
+	samples = make([]float64, int((pickup+float64(bars*beatsPerBar)*beat)*sampleRate))
+	hit := func(seconds float64, amplitude float64, freq float64, noise float64) {
+		first := int(seconds * sampleRate)
+		for i := first; i < len(samples) && i < first+sampleRate/4; i++ {
+			t := float64(i-first) / sampleRate
+			samples[i] += amplitude * math.Exp(-t*30) * (math.Sin(2*math.Pi*freq*t) + noise*(r.Float64()*2-1))
+		}
+	}
+	for b := 0; b < bars*beatsPerBar; b++ {
+		t := pickup + float64(b)*beat
+		if b%beatsPerBar == 0 {
+			hit(t, 1, 60, 0.1)
+		} else {
+			hit(t, 0.5, 200, 1)
+		}
+		hit(t+beat/2, 0.2, 8000, 1)
+	}
+	// a hat before the first bar
+	if pickup > beat/2 {
+		hit(pickup-beat/2, 0.2, 8000, 1)
+	}
+	return
+}
+
+func TestDetect(t *testing.T) {
+	for _, test := range []struct {
+		bpm    float64
+		pickup float64
+	}{
+		{120, 0},
+		{95, 0.4},
+		{140, 0.1},
+		{160, 0.25},
+	} {
+		r, err := Detect(loop(test.bpm, test.pickup, 4), sampleRate, 0)
+		assert.Nil(t, err)
+		assert.InDelta(t, test.bpm, r.BPM, 1, "%+v", test)
+		assert.InDelta(t, test.pickup, float64(r.Downbeat)/sampleRate, 0.01, "%+v", test)
+	}
+
+	// given tempo
+	r, err := Detect(loop(100, 0.3, 2), sampleRate, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 100.0, r.BPM)
+	assert.InDelta(t, 0.3, float64(r.Downbeat)/sampleRate, 0.01)
+
+	_, err = Detect(make([]float64, 1000), sampleRate, 0)
+	assert.NotNil(t, err)
+}
+
+func TestGrid(t *testing.T) {
+	beats, err := ParseGrid("1/16")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.25, beats)
+	beats, err = ParseGrid("3/8")
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, beats)
+	_, err = ParseGrid("16")
+	assert.NotNil(t, err)
+	_, err = ParseGrid("1/0")
+	assert.NotNil(t, err)
+
+	r := Result{BPM: 120, Downbeat: 1000}
+	starts, ends := r.Slices(0.25, 44100, 1000+44100, 24)
+	assert.Equal(t, 8, len(starts))
+	assert.Equal(t, 1000, starts[0])
+	assert.Equal(t, 1000+5513, starts[1])
+	assert.Equal(t, starts[1], ends[0])
+	assert.Equal(t, 1000+44100, ends[7])
+	starts, _ = r.Slices(0.25, 44100, 44100*10, 24)
+	assert.Equal(t, 24, len(starts))
+}
@@ -122,3 +122,45 @@ func RandStringBytesMaskImpr(n int) string {
 
 	return string(b)
 }
+
+// NaturalLess compares strings so that numbers are in numerical order,
+// e.g. "kick2.wav" comes before "kick10.wav"
+func NaturalLess(a, b string) bool {
+	for len(a) > 0 && len(b) > 0 {
+		aDigit := a[0] >= '0' && a[0] <= '9'
+		bDigit := b[0] >= '0' && b[0] <= '9'
+		if aDigit && bDigit {
+			aNum, aRest := splitDigits(a)
+			bNum, bRest := splitDigits(b)
+			// compare without leading zeros, then by length
+			aTrim := strings.TrimLeft(aNum, "0")
+			bTrim := strings.TrimLeft(bNum, "0")
+			if len(aTrim) != len(bTrim) {
+				return len(aTrim) < len(bTrim)
+			}
+			if aTrim != bTrim {
+				return aTrim < bTrim
+			}
+			if len(aNum) != len(bNum) {
+				return len(aNum) < len(bNum)
+			}
+			a, b = aRest, bRest
+			continue
+		}
+		aLower := strings.ToLower(a[:1])
+		bLower := strings.ToLower(b[:1])
+		if aLower != bLower {
+			return aLower < bLower
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func splitDigits(s string) (digits string, rest string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i], s[i:]
+}
@@ -30,3 +30,13 @@ func TestSecondsToString(t *testing.T) {
 	assert.Equal(t, "00:03:00.23", SecondsToString(180.23))
 	assert.Equal(t, "01:01:30.23", SecondsToString(3690.23))
 }
+
+func TestNaturalLess(t *testing.T) {
+	assert.True(t, NaturalLess("kick2.wav", "kick10.wav"))
+	assert.False(t, NaturalLess("kick10.wav", "kick2.wav"))
+	assert.True(t, NaturalLess("Hat.wav", "kick.wav"))
+	assert.True(t, NaturalLess("kick.wav", "kick1.wav"))
+	assert.True(t, NaturalLess("kick2.wav", "kick02.wav"))
+	assert.True(t, NaturalLess("a/9/b.wav", "a/10/a.wav"))
+	assert.False(t, NaturalLess("same", "same"))
+}
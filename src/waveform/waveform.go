@@ -1,20 +1,70 @@
 package waveform
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
+	"math"
+	"strings"
+	"time"
 
-	"github.com/schollz/logger"
+	"github.com/schollz/teoperator/src/audio"
+	"github.com/schollz/teoperator/src/command"
 )
 
+// timeout of audiowaveform
+const timeout = time.Minute
+
 // Image generates image of the waveform given a filename
-func Image(fnameIn, color string, length float64) (err error) {
+func Image(ctx context.Context, fnameIn, color string, length float64) (err error) {
 	cmd := []string{"-i", fnameIn, "-o", fnameIn + ".png", "--background-color", "ffffff00", "--waveform-color", color, "--amplitude-scale", "1", "--no-axis-labels", "--pixels-per-second", "100", "--height", "120", "--width",
 		fmt.Sprintf("%2.0f", length*100)}
-	logger.Debug(cmd)
-	out, err := exec.Command("audiowaveform", cmd...).CombinedOutput()
-	if err != nil {
-		logger.Errorf("audiowaveform: %s", out)
-	}
+	_, _, err = command.Run(ctx, timeout, "audiowaveform", cmd...)
 	return
 }
+
+// ASCII draws the waveform as text that is width characters wide and
+// height lines high, with a line below that marks the given seconds
+func ASCII(b *audio.Buffer, width, height int, markers []float64) string {
+	if width < 1 || height < 1 {
+		return ""
+	}
+	samples := b.Mono()
+	peaks := make([]float64, width)
+	for i, x := range samples {
+		column := i * width / len(samples)
+		peaks[column] = math.Max(peaks[column], math.Abs(x))
+	}
+
+	var sb strings.Builder
+	for row := 0; row < height; row++ {
+		// the level at the middle of the row, from 1 at the top to -1
+		level := math.Abs(1 - float64(2*row+1)/float64(height))
+		middle := level < 1/float64(height)+1e-9
+		for _, peak := range peaks {
+			switch {
+			case level < peak:
+				sb.WriteByte('#')
+			case middle:
+				sb.WriteByte('-')
+			default:
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+
+	line := []byte(strings.Repeat(" ", width))
+	if duration := b.Duration(); duration > 0 {
+		for _, seconds := range markers {
+			column := int(seconds / duration * float64(width))
+			if column >= 0 && column < width {
+				line[column] = '|'
+			} else if column == width {
+				line[width-1] = '|'
+			}
+		}
+	}
+	sb.WriteString(strings.TrimRight(string(line), " "))
+	sb.WriteByte('\n')
+	return sb.String()
+}
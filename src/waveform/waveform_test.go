@@ -0,0 +1,16 @@
+package waveform
+
+import (
+	"testing"
+
+	"github.com/schollz/teoperator/src/audio"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestASCII(t *testing.T) {
+	// a loud half and a silent half
+	b := &audio.Buffer{SampleRate: 8, Channels: 1, Samples: []float64{1, -1, 1, -1, 0, 0, 0, 0}}
+	assert.Equal(t, "##  \n##--\n##--\n##  \n| |\n", ASCII(b, 4, 4, []float64{0, 0.5}))
+	assert.Equal(t, "#-\n\n", ASCII(b, 2, 1, nil))
+	assert.Equal(t, "", ASCII(b, 0, 4, nil))
+}